@@ -11,6 +11,14 @@ const (
 	SkippedIndex
 	NoRoot
 	UnknownParticipant
+	IndexDisabled
+	DecodeError
+	OpenTimeout
+	Backpressure
+	TooManyReaders
+	CorruptValue
+	NonContiguousBlock
+	UnknownCreator
 )
 
 type StoreErr struct {
@@ -40,6 +48,22 @@ func (e StoreErr) Error() string {
 		m = "No Root"
 	case UnknownParticipant:
 		m = "Unknown Participant"
+	case IndexDisabled:
+		m = "Index Disabled"
+	case DecodeError:
+		m = "Decode Error"
+	case OpenTimeout:
+		m = "Open Timeout"
+	case Backpressure:
+		m = "Backpressure"
+	case TooManyReaders:
+		m = "Too Many Readers"
+	case CorruptValue:
+		m = "Corrupt Value"
+	case NonContiguousBlock:
+		m = "Non Contiguous Block"
+	case UnknownCreator:
+		m = "Unknown Creator"
 	}
 
 	return fmt.Sprintf("%s, %s", e.key, m)
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/dgraph-io/badger"
+)
+
+//gcRunner periodically garbage-collects badger's value log, but only when a
+//rewrite would actually reclaim space: each cycle keeps calling
+//RunValueLogGC until badger reports ErrNoRewrite, so idle databases pay for
+//nothing beyond the size check.
+type gcRunner struct {
+	interval time.Duration
+	ratio    float64
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func newGCRunner(s *BadgerStore, interval time.Duration, ratio float64) *gcRunner {
+	if ratio <= 0 || ratio >= 1 {
+		ratio = 0.5
+	}
+	g := &gcRunner{
+		interval: interval,
+		ratio:    ratio,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go g.run(s)
+	return g
+}
+
+func (g *gcRunner) run(s *BadgerStore) {
+	defer close(g.done)
+	ticker := time.NewTicker(g.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-g.stop:
+			return
+		case <-ticker.C:
+			reclaimed, err := s.runGCCycle(g.ratio)
+			if err != nil {
+				s.logger.Error().Err(err).Msg("auto gc cycle failed")
+				continue
+			}
+			if reclaimed > 0 {
+				s.logger.Info().Int64("reclaimedBytes", reclaimed).Msg("auto gc reclaimed value log space")
+			}
+		}
+	}
+}
+
+//close stops the runner and waits for an in-flight cycle to finish, so Close
+//never pulls the db out from under a running GC
+func (g *gcRunner) close() {
+	close(g.stop)
+	<-g.done
+}
+
+//runGCCycle runs value-log GC until there is nothing left to rewrite and
+//returns how many value-log bytes the cycle reclaimed. A cycle that finds
+//nothing to do is not an error.
+func (s *BadgerStore) runGCCycle(ratio float64) (int64, error) {
+	_, vlogBefore := s.db.Size()
+	for {
+		err := s.db.RunValueLogGC(ratio)
+		if err == badger.ErrNoRewrite {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	_, vlogAfter := s.db.Size()
+	reclaimed := vlogBefore - vlogAfter
+	if reclaimed < 0 {
+		reclaimed = 0
+	}
+	return reclaimed, nil
+}
@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"io/ioutil"
+	stdlog "log"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+//The vendored badger release has no pluggable Logger option; it writes
+//through the standard library's global logger. Redirecting that logger is
+//therefore a process-wide decision, not a per-store one, so it only happens
+//when a StoreConfig opts in (RouteBadgerLogs or SilenceBadgerLogs) and only
+//once: the first opted-in store wins and later stores leave the routing
+//alone rather than fighting over the global.
+
+type badgerLogAdapter struct {
+	logger *zerolog.Logger
+}
+
+func (a *badgerLogAdapter) Write(p []byte) (int, error) {
+	msg := strings.TrimSuffix(string(p), "\n")
+	if strings.HasPrefix(msg, "WARNING") {
+		a.logger.Warn().Msg(msg)
+	} else {
+		a.logger.Info().Msg(msg)
+	}
+	return len(p), nil
+}
+
+var badgerLogRouting sync.Once
+
+//routeBadgerLogs redirects the process-global stdlib logger into the given
+//zerolog logger, or to ioutil.Discard when silence is set. At most one call
+//per process takes effect; see the package note above.
+func routeBadgerLogs(logger *zerolog.Logger, silence bool) {
+	badgerLogRouting.Do(func() {
+		if silence {
+			stdlog.SetOutput(ioutil.Discard)
+			return
+		}
+		stdlog.SetFlags(0)
+		stdlog.SetOutput(&badgerLogAdapter{logger: logger})
+	})
+}
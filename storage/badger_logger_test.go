@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"bytes"
+	stdlog "log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestBadgerLogRouting(t *testing.T) {
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+
+	routeBadgerLogs(&logger, false)
+	defer stdlog.SetOutput(os.Stderr)
+
+	//badger logs through the stdlib global logger in this release
+	stdlog.Printf("Iterating file id: %d", 7)
+
+	if !strings.Contains(buf.String(), "Iterating file id: 7") {
+		t.Fatalf("badger log line not captured by the adapter: %q", buf.String())
+	}
+
+	//routing is process-global and applied at most once: a later store
+	//asking to silence must not override the first store's decision
+	buf.Reset()
+	routeBadgerLogs(&logger, true)
+	stdlog.Printf("Iterating file id: %d", 8)
+	if !strings.Contains(buf.String(), "Iterating file id: 8") {
+		t.Fatalf("second routing call should be a no-op, got %q", buf.String())
+	}
+}
@@ -1,11 +1,18 @@
 package storage
 
 import (
+	"bytes"
 	"fmt"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/dgraph-io/badger"
+	"github.com/paradigm-network/paradigm/common/crypto"
 	"github.com/paradigm-network/paradigm/errors"
 	"github.com/paradigm-network/paradigm/types"
 	"github.com/rs/zerolog"
@@ -18,24 +25,151 @@ var (
 	roundPrefix       = "round"
 	topoPrefix        = "topo"
 	blockPrefix       = "block"
+	consensusPrefix   = "consensus"
+	rootHistPrefix    = "roothist"
+	hashTopoPrefix    = "hashtopo"
+	roundBlockPrefix  = "roundblock"
+	blockHashPrefix   = "blockhash"
+	childrenPrefix    = "children"
+	blockSigPrefix    = "blocksig"
+	genesisRootPrefix = "genesisroot"
+	timePrefix        = "time"
+	rrPrefix          = "roundreceived"
+
+	participantWeightPrefix = "participantweight"
+
+	//first round that may still have undecided witnesses
+	undecidedWatermarkKey = []byte("undecidedwatermark")
+
+	//monotonically increasing counter bumped on discontinuities (Reset)
+	generationKey = []byte("generation")
+
+	//name of the comet codec the store was written with
+	codecKey = []byte("codec")
+
+	//index of the last block the state machine durably applied
+	lastAppliedKey = []byte("lastapplied")
+
+	//indirection over badger.Open so tests can inject a slow open
+	badgerOpen = badger.Open
 )
 
+//openBadgerDB wraps badgerOpen with an optional deadline. Value log replay
+//can outlast a supervisor's startup budget on contended disks, so callers
+//can bound it; a handle that arrives after the deadline is closed so the
+//directory lock is not leaked.
+func openBadgerDB(opts badger.Options, timeout time.Duration) (*badger.DB, error) {
+	if timeout <= 0 {
+		return badgerOpen(opts)
+	}
+	type openResult struct {
+		handle *badger.DB
+		err    error
+	}
+	ch := make(chan openResult, 1)
+	go func() {
+		handle, err := badgerOpen(opts)
+		ch <- openResult{handle, err}
+	}()
+	select {
+	case res := <-ch:
+		return res.handle, res.err
+	case <-time.After(timeout):
+		go func() {
+			if res := <-ch; res.handle != nil {
+				res.handle.Close()
+			}
+		}()
+		return nil, errors.NewStoreErr(errors.OpenTimeout, opts.Dir)
+	}
+}
+
 type BadgerStore struct {
-	participants map[string]int
-	inmemStore   *InmemStore
+	participants     map[string]int
+	participantsLock sync.RWMutex
+	inmemStore       *InmemStore
 	db           *badger.DB
+	kv           kvEngine //engine-agnostic view of db, see kv_engine.go
+	//separate db for the app-facing KV namespace, nil when shared with db
+	metaDB *badger.DB
+	appKV  kvEngine //backs Get/Has/Put, either kv or a view of metaDB
 	path         string
-	logger       *zerolog.Logger
+	conf         *StoreConfig
+	writeSem     chan struct{} //bounds in-flight writes, nil when unlimited
+	writeBuf     *writeBuffer  //batches durable writes, nil when disabled
+	gc           *gcRunner     //periodic value-log GC, nil when disabled
+	//next persisted consensus event index, lazily seeded from the db
+	consensusIndex int
+	metrics        storeMetrics
+	//optional admission check run by SetComet before anything is written
+	validator func(types.Comet) error
+	logger    *zerolog.Logger
+	//topo index entries buffered by LazyTopoIndex, flushed in batches
+	pendingTopo     map[int]string
+	pendingTopoLock sync.Mutex
+	//last stored block index for StrictBlockOrder, -2 until seeded
+	lastBlockIndex int64
+	blockIndexLock sync.Mutex
+	//serializes read-modify-write round mutations and their cache refresh
+	roundMutateLock sync.Mutex
+	//serializes RunMaintenance calls so ticker schedules cannot overlap
+	maintenanceLock sync.Mutex
+	//application key namespaces handed out by RegisterPrefix
+	appPrefixes     map[string]struct{}
+	appPrefixesLock sync.Mutex
+	//currently open tracked read transactions, see OpenReader
+	openReaders int64
+	//cached total number of stored events, -1 until seeded by EventsCount
+	eventsCount int64
+	//cached highest topological index, -2 until seeded; -1 means no events
+	maxTopoIndex int64
+	//memoized EventDepth results, populated on demand
+	depthCache     map[string]int
+	depthCacheLock sync.Mutex
+	//optional hot-standby target for mirrored writes, holds a mirrorTarget;
+	//see WriteMirror
+	mirror atomic.Value
+	//per-creator ingestion counters, see ParticipantEventRates
+	creatorRates creatorCounts
+	//explicit participant weights, lazily loaded; see participant_weights.go
+	weights    map[string]uint64
+	weightLock sync.Mutex
+	//cached TotalWeight sum, -1 until seeded
+	totalWeight int64
+	//test-only crash injection point, see crashPoint
+	crashHook func(point string) error
+	//on-disk encoding for comets, recorded under codecKey
+	codec cometCodec
 }
 
 //NewBadgerStore creates a brand new Store with a new database
 func NewBadgerStore(participants map[string]int, cacheSize int, path string) (*BadgerStore, error) {
+	return NewBadgerStoreWithConfig(participants, cacheSize, path, DefaultStoreConfig())
+}
+
+//NewBadgerStoreWithConfig creates a brand new Store with a new database and
+//a custom StoreConfig
+func NewBadgerStoreWithConfig(participants map[string]int, cacheSize int, path string, conf *StoreConfig) (*BadgerStore, error) {
+	if conf == nil {
+		conf = DefaultStoreConfig()
+	}
+	codec, err := codecByName(conf.Codec)
+	if err != nil {
+		return nil, err
+	}
+	logger := log.GetLogger("badger")
+	if conf.RouteBadgerLogs || conf.SilenceBadgerLogs {
+		routeBadgerLogs(logger, conf.SilenceBadgerLogs)
+	}
+	if err := createStoreDir(path, conf.DirPerm); err != nil {
+		return nil, err
+	}
 	inmemStore := NewInmemStore(participants, cacheSize)
 	opts := badger.DefaultOptions
 	opts.Dir = path
 	opts.ValueDir = path
 	opts.SyncWrites = false
-	handle, err := badger.Open(opts)
+	handle, err := openBadgerDB(opts, conf.OpenTimeout)
 	if err != nil {
 		return nil, err
 	}
@@ -43,10 +177,46 @@ func NewBadgerStore(participants map[string]int, cacheSize int, path string) (*B
 		participants: participants,
 		inmemStore:   inmemStore,
 		db:           handle,
+		kv:           &badgerKV{db: handle},
 		path:         path,
-		logger:       log.GetLogger("badger"),
+		conf:           conf,
+		writeSem:       newWriteSem(conf),
+		consensusIndex: -1,
+		eventsCount:    -1,
+		lastBlockIndex: -2,
+		maxTopoIndex:   -2,
+		totalWeight:    -1,
+		logger:         logger,
+		codec:          codec,
+	}
+	store.appKV = store.kv
+	if conf.MetadataPath != "" {
+		if err := createStoreDir(conf.MetadataPath, conf.DirPerm); err != nil {
+			return nil, err
+		}
+		metaOpts := badger.DefaultOptions
+		metaOpts.Dir = conf.MetadataPath
+		metaOpts.ValueDir = conf.MetadataPath
+		metaOpts.SyncWrites = false
+		metaHandle, err := openBadgerDB(metaOpts, conf.OpenTimeout)
+		if err != nil {
+			handle.Close()
+			return nil, err
+		}
+		store.metaDB = metaHandle
+		store.appKV = &badgerKV{db: metaHandle}
+	}
+	if conf.WriteBufferSize > 0 {
+		store.writeBuf = newWriteBuffer(store, conf.WriteBufferSize)
+	}
+	if conf.AutoGCInterval > 0 {
+		store.gc = newGCRunner(store, conf.AutoGCInterval, conf.AutoGCDiscardRatio)
 	}
 
+	//record the codec so the store is always read back with it
+	if err := store.kv.Set(codecKey, []byte(codec.Name())); err != nil {
+		return nil, err
+	}
 	if err := store.dbSetParticipants(participants); err != nil {
 		return nil, err
 	}
@@ -54,29 +224,76 @@ func NewBadgerStore(participants map[string]int, cacheSize int, path string) (*B
 	if err := store.dbSetRoots(inmemStore.roots); err != nil {
 		return nil, err
 	}
+	if err := store.dbSetGenesisRoots(inmemStore.roots); err != nil {
+		return nil, err
+	}
+	//a fresh store has nothing to pin yet, but invalid names fail at open
+	if err := store.pinHotKeys(); err != nil {
+		return nil, err
+	}
 	return store, nil
 }
 
 //LoadBadgerStore creates a Store from an existing database
 func LoadBadgerStore(cacheSize int, path string) (*BadgerStore, error) {
+	return LoadBadgerStoreWithConfig(cacheSize, path, DefaultStoreConfig())
+}
 
-	if _, err := os.Stat(path); err != nil {
+//LoadBadgerStoreWithConfig creates a Store from an existing database with a
+//custom StoreConfig
+func LoadBadgerStoreWithConfig(cacheSize int, path string, conf *StoreConfig) (*BadgerStore, error) {
+
+	info, err := os.Stat(path)
+	if err != nil {
 		return nil, err
 	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("store path %s exists but is not a directory", path)
+	}
 
+	if conf == nil {
+		conf = DefaultStoreConfig()
+	}
+	logger := log.GetLogger("badger")
+	if conf.RouteBadgerLogs || conf.SilenceBadgerLogs {
+		routeBadgerLogs(logger, conf.SilenceBadgerLogs)
+	}
 	opts := badger.DefaultOptions
 	opts.Dir = path
 	opts.ValueDir = path
 	opts.SyncWrites = false
-	handle, err := badger.Open(opts)
+	handle, err := openBadgerDB(opts, conf.OpenTimeout)
 	if err != nil {
 		return nil, err
 	}
 	store := &BadgerStore{
-		db:     handle,
-		path:   path,
-		logger: log.GetLogger("badger"),
+		db:             handle,
+		kv:             &badgerKV{db: handle},
+		path:           path,
+		conf:           conf,
+		writeSem:       newWriteSem(conf),
+		consensusIndex: -1,
+		eventsCount:    -1,
+		lastBlockIndex: -2,
+		maxTopoIndex:   -2,
+		totalWeight:    -1,
+		logger:         logger,
+	}
+	store.appKV = store.kv
+
+	//adopt the codec the store was written with; stores that predate the
+	//codec record used the default encoding
+	codecName := ""
+	if v, err := store.kv.Get(codecKey); err == nil {
+		codecName = string(v)
+	} else if !isDBKeyNotFound(err) {
+		return nil, err
+	}
+	codec, err := codecByName(codecName)
+	if err != nil {
+		return nil, err
 	}
+	store.codec = codec
 
 	participants, err := store.dbGetParticipants()
 	if err != nil {
@@ -85,14 +302,10 @@ func LoadBadgerStore(cacheSize int, path string) (*BadgerStore, error) {
 
 	inmemStore := NewInmemStore(participants, cacheSize)
 
-	//read roots from db and put them in InmemStore
-	roots := make(map[string]types.Root)
-	for p := range participants {
-		root, err := store.dbGetRoot(p)
-		if err != nil {
-			return nil, err
-		}
-		roots[p] = root
+	//read roots from db in one View and put them in InmemStore
+	roots, err := store.dbGetAllRoots(participants)
+	if err != nil {
+		return nil, err
 	}
 
 	if err := inmemStore.Reset(roots); err != nil {
@@ -102,9 +315,211 @@ func LoadBadgerStore(cacheSize int, path string) (*BadgerStore, error) {
 	store.participants = participants
 	store.inmemStore = inmemStore
 
+	if conf.MetadataPath != "" {
+		if err := createStoreDir(conf.MetadataPath, conf.DirPerm); err != nil {
+			return nil, err
+		}
+		metaOpts := badger.DefaultOptions
+		metaOpts.Dir = conf.MetadataPath
+		metaOpts.ValueDir = conf.MetadataPath
+		metaOpts.SyncWrites = false
+		metaHandle, err := openBadgerDB(metaOpts, conf.OpenTimeout)
+		if err != nil {
+			handle.Close()
+			return nil, err
+		}
+		store.metaDB = metaHandle
+		store.appKV = &badgerKV{db: metaHandle}
+	}
+	if conf.WriteBufferSize > 0 {
+		store.writeBuf = newWriteBuffer(store, conf.WriteBufferSize)
+	}
+	if conf.AutoGCInterval > 0 {
+		store.gc = newGCRunner(store, conf.AutoGCInterval, conf.AutoGCDiscardRatio)
+	}
+	if conf.WarmOnLoad {
+		if err := store.warmCaches(); err != nil {
+			return nil, err
+		}
+	}
+	if err := store.pinHotKeys(); err != nil {
+		return nil, err
+	}
+
 	return store, nil
 }
 
+//warmCaches preloads the most recent rounds and the tail of the persisted
+//consensus list into the InmemStore, so the first consensus tick after a
+//restart is served from cache instead of from many single disk reads.
+func (s *BadgerStore) warmCaches() error {
+	n := s.conf.WarmRounds
+	if n <= 0 {
+		n = s.inmemStore.CacheSize()
+	}
+	last, err := s.MaxKnownRound()
+	if err != nil {
+		return err
+	}
+	first := last - n + 1
+	if first < 0 {
+		first = 0
+	}
+	for r := first; r <= last; r++ {
+		round, err := s.dbGetRound(r)
+		if err != nil {
+			if isDBKeyNotFound(err) {
+				continue
+			}
+			return err
+		}
+		if err := s.inmemStore.SetRound(r, round); err != nil {
+			return err
+		}
+	}
+
+	//replay the consensus tail at its true positions
+	total, err := s.dbConsensusEventsCount()
+	if err != nil {
+		return err
+	}
+	firstConsensus := total - s.inmemStore.CacheSize()
+	if firstConsensus < 0 {
+		firstConsensus = 0
+	}
+	for i := firstConsensus; i < total; i++ {
+		v, err := s.kvGet(consensusEventKey(i))
+		if err != nil {
+			return mapError(err, string(consensusEventKey(i)))
+		}
+		if err := s.inmemStore.consensusCache.Set(string(v), i); err != nil {
+			return err
+		}
+	}
+	s.inmemStore.totConsensusEvents = total
+
+	return nil
+}
+
+//pinHotKeys resolves the configured PinKeys into pinned cache entries:
+//the hottest consensus data stays resident however the LRU churns. Roots
+//need no pin because they live outside the LRU caches.
+func (s *BadgerStore) pinHotKeys() error {
+	for _, name := range s.conf.PinKeys {
+		switch name {
+		case "roots":
+			//always resident, nothing to pin
+		case "last-round":
+			r, err := s.MaxKnownRound()
+			if err != nil {
+				return err
+			}
+			if r < 0 {
+				continue
+			}
+			round, err := s.dbGetRound(r)
+			if err != nil {
+				if isDBKeyNotFound(err) {
+					continue
+				}
+				return err
+			}
+			s.inmemStore.PinRound(r, round)
+		case "last-block":
+			last, err := s.dbLastNBlocks(1)
+			if err != nil {
+				return err
+			}
+			if len(last) == 0 {
+				continue
+			}
+			s.inmemStore.PinBlock(last[0])
+		default:
+			return fmt.Errorf("unknown pin key %q", name)
+		}
+	}
+	return nil
+}
+
+//RefreshFromDisk rebuilds the cached view from the current db contents
+//without closing and reopening the handle: participants and roots are
+//re-read from badger, the InmemStore is reinitialized, the cached counters
+//are invalidated and, when the store was configured with WarmOnLoad, the
+//recent caches are warmed again. Replicas use it to re-sync their view
+//after a Truncate, an external badger modification or a detected
+//generation change.
+func (s *BadgerStore) RefreshFromDisk() error {
+	if s.writeBuf != nil {
+		s.writeBuf.drain()
+	}
+	participants, err := s.dbGetParticipants()
+	if err != nil {
+		return err
+	}
+	roots, err := s.dbGetAllRoots(participants)
+	if err != nil {
+		return err
+	}
+	inmemStore := NewInmemStore(participants, s.inmemStore.CacheSize())
+	if err := inmemStore.Reset(roots); err != nil {
+		return err
+	}
+	//swap both views under the participants lock so concurrent readers see
+	//either the old or the new state, never a mix
+	s.participantsLock.Lock()
+	s.participants = participants
+	s.inmemStore = inmemStore
+	s.participantsLock.Unlock()
+	atomic.StoreInt64(&s.eventsCount, -1)
+	atomic.StoreInt64(&s.maxTopoIndex, -2)
+	s.blockIndexLock.Lock()
+	s.lastBlockIndex = -2
+	s.blockIndexLock.Unlock()
+	if s.conf.WarmOnLoad {
+		if err := s.warmCaches(); err != nil {
+			return err
+		}
+	}
+	return s.pinHotKeys()
+}
+
+//createStoreDir creates the database directory with the requested mode when
+//it does not exist yet. MkdirAll is filtered by the process umask, so the
+//mode is enforced with an explicit Chmod afterwards.
+func createStoreDir(path string, perm os.FileMode) error {
+	if perm == 0 {
+		perm = 0700
+	}
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.MkdirAll(path, perm); err != nil {
+		return err
+	}
+	return os.Chmod(path, perm)
+}
+
+func newWriteSem(conf *StoreConfig) chan struct{} {
+	if conf.MaxConcurrentWrites <= 0 {
+		return nil
+	}
+	return make(chan struct{}, conf.MaxConcurrentWrites)
+}
+
+func (s *BadgerStore) acquireWrite() {
+	if s.writeSem != nil {
+		s.writeSem <- struct{}{}
+	}
+}
+
+func (s *BadgerStore) releaseWrite() {
+	if s.writeSem != nil {
+		<-s.writeSem
+	}
+}
+
 //==============================================================================
 //Keys
 
@@ -124,171 +539,2235 @@ func participantRootKey(participant string) []byte {
 	return []byte(fmt.Sprintf("%s_%s", participant, rootSuffix))
 }
 
-func roundKey(index int) []byte {
-	return []byte(fmt.Sprintf("%s_%09d", roundPrefix, index))
+func genesisRootKey(participant string) []byte {
+	return []byte(fmt.Sprintf("%s_%s", genesisRootPrefix, participant))
 }
 
-func blockKey(index int) []byte {
-	return []byte(fmt.Sprintf("%s_%09d", blockPrefix, index))
+func rootHistoryKey(participant string, seq int) []byte {
+	return []byte(fmt.Sprintf("%s_%s_%09d", rootHistPrefix, participant, seq))
 }
 
-//==============================================================================
-//Implement the Store interface
-
-func (s *BadgerStore) CacheSize() int {
-	return s.inmemStore.CacheSize()
+func roundKey(index int) []byte {
+	return []byte(fmt.Sprintf("%s_%09d", roundPrefix, index))
 }
 
-func (s *BadgerStore) Participants() (map[string]int, error) {
-	return s.participants, nil
+func roundBlockKey(roundReceived int) []byte {
+	return []byte(fmt.Sprintf("%s_%09d", roundBlockPrefix, roundReceived))
 }
 
-func (s *BadgerStore) GetComet(key string) (comet types.Comet, err error) {
-	//try to get it from cache
-	comet, err = s.inmemStore.GetComet(key)
-	//if not in cache, try to get it from db
-	if err != nil {
-		comet, err = s.dbGetEvent(key)
-	}
-	return comet, mapError(err, key)
+func hashTopoKey(hex string) []byte {
+	return []byte(fmt.Sprintf("%s_%s", hashTopoPrefix, hex))
 }
 
-func (s *BadgerStore) SetComet(comet types.Comet) error {
-	//try to add it to the cache
-	if err := s.inmemStore.SetComet(comet); err != nil {
-		return err
-	}
-	//try to add it to the db
-	return s.dbSetEvents([]types.Comet{comet})
+func consensusEventKey(index int) []byte {
+	return []byte(fmt.Sprintf("%s_%09d", consensusPrefix, index))
 }
 
-func (s *BadgerStore) ParticipantEvents(participant string, skip int) ([]string, error) {
-	res, err := s.inmemStore.ParticipantEvents(participant, skip)
-	if err != nil {
-		res, err = s.dbParticipantEvents(participant, skip)
-	}
-	return res, err
+func blockKey(index int) []byte {
+	return []byte(fmt.Sprintf("%s_%09d", blockPrefix, index))
 }
 
-func (s *BadgerStore) ParticipantEvent(participant string, index int) (string, error) {
-	result, err := s.inmemStore.ParticipantEvent(participant, index)
-	if err != nil {
-		result, err = s.dbParticipantEvent(participant, index)
-	}
-	return result, mapError(err, string(participantEventKey(participant, index)))
+func blockHashKey(index int) []byte {
+	return []byte(fmt.Sprintf("%s_%09d", blockHashPrefix, index))
 }
 
-func (s *BadgerStore) LastEventFrom(participant string) (last string, isRoot bool, err error) {
-	return s.inmemStore.LastEventFrom(participant)
+func childKey(parent, child string) []byte {
+	return []byte(fmt.Sprintf("%s_%s_%s", childrenPrefix, parent, child))
 }
 
-func (s *BadgerStore) KnownEvents() map[int]int {
-	known := make(map[int]int)
-	for p, pid := range s.participants {
-		index := -1
-		last, isRoot, err := s.LastEventFrom(p)
-		s.logger.Info().Str("participant", p).Bool("isRoot", isRoot).Str("lastKet", last).Msg("KnownEvents:LastEventFrom")
-		if err == nil {
-			if isRoot {
-				root, err := s.GetRoot(p)
-				s.logger.Info().Str("participant", p).Bool("isRoot", isRoot).Int("rootIndex", root.Index).Msg("KnownEvents:GetRoot")
-				if err != nil {
-					last = root.X
-					index = root.Index
-				}
-			} else {
-				lastEvent, err := s.GetComet(last)
-				s.logger.Info().Str("participant", p).Bool("isRoot", isRoot).Int("eventIndex", lastEvent.Index()).Msg("KnownEvents:GetComet")
-				if err == nil {
-					index = lastEvent.Index()
-				}
-			}
+//roundReceivedKey indexes an event under the round it was received in, so
+//consensus-order reads touch only the rounds they ask for
+func roundReceivedKey(roundReceived int, hex string) []byte {
+	return []byte(fmt.Sprintf("%s_%09d_%s", rrPrefix, roundReceived, hex))
+}
 
-		}
-		known[pid] = index
-	}
-	return known
+//timeKey orders events by their creator-claimed timestamp. The fixed-width
+//nanosecond count keeps the lexicographic and numeric orders aligned; the
+//hash suffix disambiguates identical timestamps.
+func timeKey(unixNanos int64, hex string) []byte {
+	return []byte(fmt.Sprintf("%s_%020d_%s", timePrefix, unixNanos, hex))
 }
 
-func (s *BadgerStore) ConsensusEvents() []string {
-	return s.inmemStore.ConsensusEvents()
+func blockSigKey(index int, validator string) []byte {
+	return []byte(fmt.Sprintf("%s_%09d_%s", blockSigPrefix, index, validator))
 }
 
-func (s *BadgerStore) ConsensusEventsCount() int {
-	return s.inmemStore.ConsensusEventsCount()
+//==============================================================================
+//Implement the Store interface
+
+func (s *BadgerStore) CacheSize() int {
+	return s.inmemStore.CacheSize()
 }
 
-func (s *BadgerStore) AddConsensusEvent(key string) error {
-	return s.inmemStore.AddConsensusEvent(key)
+//Participants returns a copy of the participants map so callers never
+//observe concurrent membership changes
+func (s *BadgerStore) Participants() (map[string]int, error) {
+	s.participantsLock.RLock()
+	defer s.participantsLock.RUnlock()
+	res := make(map[string]int, len(s.participants))
+	for p, id := range s.participants {
+		res[p] = id
+	}
+	return res, nil
 }
 
-func (s *BadgerStore) GetRound(r int) (types.RoundInfo, error) {
-	res, err := s.inmemStore.GetRound(r)
+//VerifyParticipants compares the persisted participant set against an
+//expected one, typically from the genesis file, and reports every extra
+//pubkey, missing pubkey and id mismatch in one detailed error. It guards
+//against running with an unexpected validator set after a bad restore or
+//db tampering; nil means the sets agree exactly.
+func (s *BadgerStore) VerifyParticipants(expected map[string]int) error {
+	persisted, err := s.dbGetParticipants()
 	if err != nil {
-		res, err = s.dbGetRound(r)
+		return err
 	}
-	return res, mapError(err, string(roundKey(r)))
+	extra := []string{}
+	missing := []string{}
+	mismatched := []string{}
+	for p, id := range persisted {
+		expectedID, ok := expected[p]
+		if !ok {
+			extra = append(extra, p)
+			continue
+		}
+		if id != expectedID {
+			mismatched = append(mismatched, fmt.Sprintf("%s (persisted %d, expected %d)", p, id, expectedID))
+		}
+	}
+	for p := range expected {
+		if _, ok := persisted[p]; !ok {
+			missing = append(missing, p)
+		}
+	}
+	if len(extra) == 0 && len(missing) == 0 && len(mismatched) == 0 {
+		return nil
+	}
+	sort.Strings(extra)
+	sort.Strings(missing)
+	sort.Strings(mismatched)
+	return fmt.Errorf("participant set mismatch: extra %v, missing %v, id mismatch %v",
+		extra, missing, mismatched)
 }
 
-func (s *BadgerStore) SetRound(r int, round types.RoundInfo) error {
-	if err := s.inmemStore.SetRound(r, round); err != nil {
-		return err
+//GetParticipantID returns the id of a known participant
+func (s *BadgerStore) GetParticipantID(participant string) (int, error) {
+	s.participantsLock.RLock()
+	defer s.participantsLock.RUnlock()
+	id, ok := s.participants[participant]
+	if !ok {
+		return -1, errors.NewStoreErr(errors.UnknownParticipant, participant)
 	}
-	return s.dbSetRound(r, round)
+	return id, nil
 }
 
-func (s *BadgerStore) LastRound() int {
-	return s.inmemStore.LastRound()
+//SetValidator installs an admission check that SetComet runs before writing.
+//A non-nil error from the validator rejects the event without touching the
+//cache or the db.
+func (s *BadgerStore) SetValidator(v func(types.Comet) error) {
+	s.validator = v
 }
 
-func (s *BadgerStore) RoundWitnesses(r int) []string {
-	round, err := s.GetRound(r)
-	if err != nil {
-		return []string{}
+//crashPoint runs the test-only crashHook at a named point in a multi-step
+//write, letting recovery tests abort deterministically between the cache
+//update and the badger commit. Hooked points: "setcomet:pre-db",
+//"batchset:pre-db" and "setblock:pre-db". A non-nil error from the hook
+//aborts the operation there, leaving exactly the state a crash at that
+//point would leave. Production code must never set crashHook.
+func (s *BadgerStore) crashPoint(point string) error {
+	if s.crashHook != nil {
+		return s.crashHook(point)
 	}
-	return round.Witnesses()
+	return nil
 }
 
-func (s *BadgerStore) RoundEvents(r int) int {
-	round, err := s.GetRound(r)
-	if err != nil {
-		return 0
-	}
-	return len(round.Events)
+//AddParticipant registers a new participant and persists it. The in-memory
+//event caches are not extended retroactively; this is groundwork for dynamic
+//membership.
+func (s *BadgerStore) AddParticipant(participant string, id int) error {
+	s.participantsLock.Lock()
+	s.participants[participant] = id
+	s.participantsLock.Unlock()
+	//a new member weighs the default 1 until given an explicit weight
+	s.weightLock.Lock()
+	s.totalWeight = -1
+	s.weightLock.Unlock()
+	return s.dbSetParticipants(map[string]int{participant: id})
 }
 
-func (s *BadgerStore) GetRoot(participant string) (types.Root, error) {
-	root, err := s.inmemStore.GetRoot(participant)
-	if err != nil {
-		root, err = s.dbGetRoot(participant)
+//VerifyCometSignature checks a comet's signature over its body after
+//confirming the creator is a known participant, so relaying code can reject
+//events from strangers before doing any crypto. The ecdsa check itself is
+//delegated to the types package. An unknown creator yields an
+//errors.UnknownParticipant error.
+func (s *BadgerStore) VerifyCometSignature(comet types.Comet) (bool, error) {
+	if _, err := s.GetParticipantID(comet.Creator()); err != nil {
+		return false, err
 	}
-	return root, mapError(err, string(participantRootKey(participant)))
+	return comet.Verify()
 }
 
-func (s *BadgerStore) GetBlock(rr int) (types.Block, error) {
-	res, err := s.inmemStore.GetBlock(rr)
-	if err != nil {
-		res, err = s.dbGetBlock(rr)
+func (s *BadgerStore) GetComet(key string) (comet types.Comet, err error) {
+	//try to get it from cache
+	comet, err = s.inmemStore.GetComet(key)
+	cacheHit := err == nil
+	//if not in cache, try to get it from db
+	if err != nil {
+		comet, err = s.dbGetEvent(key)
+	}
+	s.metrics.read(cacheHit, err)
+	return comet, mapError(err, key)
+}
+
+//GetCometInto is the allocation-shy variant of GetComet for hot sync loops:
+//the event is decoded straight into dst, which is overwritten wholesale. On
+//the db path the raw bytes are decoded inside the read transaction, so no
+//intermediate copy of the value is made.
+func (s *BadgerStore) GetCometInto(key string, dst *types.Comet) error {
+	if cached, err := s.inmemStore.GetComet(key); err == nil {
+		*dst = cached
+		s.metrics.read(true, nil)
+		return nil
+	}
+	err := s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(key))
+		if err != nil {
+			return err
+		}
+		v, err := item.Value()
+		if err != nil {
+			return err
+		}
+		*dst = types.Comet{}
+		if err := s.codec.Unmarshal(v, dst); err != nil {
+			//present but undecodable: corruption, not absence
+			return errors.NewStoreErr(errors.DecodeError, key)
+		}
+		return nil
+	})
+	s.metrics.read(false, err)
+	return mapError(err, key)
+}
+
+func (s *BadgerStore) SetComet(comet types.Comet) error {
+	if s.conf.StrictCreators {
+		creator := comet.Creator()
+		s.participantsLock.RLock()
+		_, known := s.participants[creator]
+		s.participantsLock.RUnlock()
+		if !known {
+			return errors.NewStoreErr(errors.UnknownCreator, creator)
+		}
+	}
+	if s.validator != nil {
+		if err := s.validator(comet); err != nil {
+			return err
+		}
+	}
+	//try to add it to the cache
+	if err := s.inmemStore.SetComet(comet); err != nil {
+		return err
+	}
+	//buffered path: the durable write is handed to the flusher
+	if s.writeBuf != nil {
+		if err := s.writeBuf.enqueue(comet, s.conf.NonBlockingWrites); err != nil {
+			return err
+		}
+		s.creatorRates.inc(comet.Creator())
+		s.mirrorComet(comet)
+		return nil
+	}
+	if err := s.crashPoint("setcomet:pre-db"); err != nil {
+		return err
+	}
+	//try to add it to the db
+	s.acquireWrite()
+	defer s.releaseWrite()
+	err := s.dbSetEvents([]types.Comet{comet})
+	s.metrics.write(err)
+	if err == nil {
+		s.creatorRates.inc(comet.Creator())
+		s.mirrorComet(comet)
+	}
+	return err
+}
+
+//BulkLoadComets imports events for single-writer bulk loads, skipping the
+//per-event existence probes dbSetEvents performs. This badger tracks
+//conflicts through the keys a write transaction has read (there is no
+//engine-level DetectConflicts toggle in v1), so a probe-free import
+//commits without any conflict-detection work. Events are assumed new and
+//written blindly in batches; running this concurrently with other writers
+//is unsafe and can corrupt the indexes with duplicate entries. The cache
+//is not updated; warm it afterwards if needed.
+func (s *BadgerStore) BulkLoadComets(comets []types.Comet) error {
+	const batchSize = 1000
+	for start := 0; start < len(comets); start += batchSize {
+		end := start + batchSize
+		if end > len(comets) {
+			end = len(comets)
+		}
+		tx := s.db.NewTransaction(true)
+		for _, comet := range comets[start:end] {
+			cometHex := comet.Hex()
+			val, err := s.codec.Marshal(&comet)
+			if err != nil {
+				tx.Discard()
+				return err
+			}
+			if err := tx.Set([]byte(cometHex), val); err != nil {
+				tx.Discard()
+				return err
+			}
+			if !s.conf.DisableTopoIndex {
+				topoKey := topologicalEventKey(comet.TopologicalIndex)
+				if err := tx.Set(topoKey, []byte(cometHex)); err != nil {
+					tx.Discard()
+					return err
+				}
+				htKey := hashTopoKey(cometHex)
+				htVal := []byte(strconv.Itoa(comet.TopologicalIndex))
+				if err := tx.Set(htKey, htVal); err != nil {
+					tx.Discard()
+					return err
+				}
+			}
+			if !s.conf.DisableParticipantIndex {
+				peKey := participantEventKey(comet.Creator(), comet.Index())
+				if err := tx.Set(peKey, []byte(cometHex)); err != nil {
+					tx.Discard()
+					return err
+				}
+			}
+			for _, parent := range comet.Body.Parents {
+				if parent == "" {
+					continue
+				}
+				if err := tx.Set(childKey(parent, cometHex), []byte(cometHex)); err != nil {
+					tx.Discard()
+					return err
+				}
+			}
+			if comet.RoundReceived != nil {
+				rrKey := roundReceivedKey(*comet.RoundReceived, cometHex)
+				if err := tx.Set(rrKey, []byte(cometHex)); err != nil {
+					tx.Discard()
+					return err
+				}
+			}
+		}
+		if err := tx.Commit(nil); err != nil {
+			tx.Discard()
+			return err
+		}
+	}
+	//the import bypassed the counter bookkeeping; reseed lazily
+	atomic.StoreInt64(&s.eventsCount, -1)
+	atomic.StoreInt64(&s.maxTopoIndex, -2)
+	return nil
+}
+
+//StoreComet is SetComet with the topological index actually used reported
+//back, for callers that index the event immediately after storing it. Today
+//that is the index the comet was created with; once the store assigns topo
+//indexes itself this return value is the one to trust.
+func (s *BadgerStore) StoreComet(comet types.Comet) (int, error) {
+	if err := s.SetComet(comet); err != nil {
+		return -1, err
+	}
+	return comet.TopologicalIndex, nil
+}
+
+//BatchSetComets stores a batch of events through a single cache pass and a
+//single db transaction
+func (s *BadgerStore) BatchSetComets(comets []types.Comet) error {
+	if s.validator != nil {
+		for _, comet := range comets {
+			if err := s.validator(comet); err != nil {
+				return err
+			}
+		}
+	}
+	if err := s.inmemStore.SetComets(comets); err != nil {
+		return err
+	}
+	if err := s.crashPoint("batchset:pre-db"); err != nil {
+		return err
+	}
+	s.acquireWrite()
+	defer s.releaseWrite()
+	return s.dbSetEvents(comets)
+}
+
+//SetCometWithTTL stores an event whose db entries expire after ttl, for
+//relay nodes that forward events without retaining them forever. The topo,
+//participant and children index entries carry the same TTL so nothing
+//dangles after expiry. The cache is deliberately not updated: a cached copy
+//would outlive the db entries and mask the expiry, so the typed getters
+//keep reporting errors.KeyNotFound once the TTL has passed.
+func (s *BadgerStore) SetCometWithTTL(comet types.Comet, ttl time.Duration) error {
+	if s.conf.StrictCreators {
+		creator := comet.Creator()
+		s.participantsLock.RLock()
+		_, known := s.participants[creator]
+		s.participantsLock.RUnlock()
+		if !known {
+			return errors.NewStoreErr(errors.UnknownCreator, creator)
+		}
+	}
+	if s.validator != nil {
+		if err := s.validator(comet); err != nil {
+			return err
+		}
+	}
+	s.acquireWrite()
+	defer s.releaseWrite()
+
+	tx := s.db.NewTransaction(true)
+	defer tx.Discard()
+
+	cometHex := comet.Hex()
+	val, err := s.codec.Marshal(&comet)
+	if err != nil {
+		return err
+	}
+	if err := tx.SetWithTTL([]byte(cometHex), val, ttl); err != nil {
+		return err
+	}
+	if !s.conf.DisableTopoIndex {
+		if err := tx.SetWithTTL(topologicalEventKey(comet.TopologicalIndex), []byte(cometHex), ttl); err != nil {
+			return err
+		}
+		htVal := []byte(strconv.Itoa(comet.TopologicalIndex))
+		if err := tx.SetWithTTL(hashTopoKey(cometHex), htVal, ttl); err != nil {
+			return err
+		}
+	}
+	if !s.conf.DisableParticipantIndex {
+		peKey := participantEventKey(comet.Creator(), comet.Index())
+		if err := tx.SetWithTTL(peKey, []byte(cometHex), ttl); err != nil {
+			return err
+		}
+	}
+	for _, parent := range comet.Body.Parents {
+		if parent == "" {
+			continue
+		}
+		if err := tx.SetWithTTL(childKey(parent, cometHex), []byte(cometHex), ttl); err != nil {
+			return err
+		}
+	}
+	err = tx.Commit(nil)
+	s.metrics.write(err)
+	return err
+}
+
+//GetEventBytes returns the raw marshaled bytes of an event without decoding
+//them to a types.Comet
+func (s *BadgerStore) GetEventBytes(hash string) ([]byte, error) {
+	data, err := s.kvGet([]byte(hash))
+	return data, mapError(err, hash)
+}
+
+//SetEventBytes stores pre-marshaled event bytes verbatim while maintaining
+//the same indexes as dbSetEvents. The children, time and round-received
+//entries need fields that only exist inside the bytes, so they are decoded
+//once here for bookkeeping; the stored value is still exactly what the
+//caller passed, and the typed getters pay the only other decode.
+func (s *BadgerStore) SetEventBytes(hash string, topoIndex, participantIndex int, creator string, data []byte) error {
+	comet := new(types.Comet)
+	if err := s.codec.Unmarshal(data, comet); err != nil {
+		return errors.NewStoreErr(errors.DecodeError, hash)
+	}
+
+	s.acquireWrite()
+	defer s.releaseWrite()
+
+	tx := s.db.NewTransaction(true)
+	defer tx.Discard()
+
+	//check if it already exists
+	new := false
+	_, err := tx.Get([]byte(hash))
+	if err != nil && isDBKeyNotFound(err) {
+		new = true
+	}
+	//insert [event hash] => [event bytes]
+	if err := tx.Set([]byte(hash), data); err != nil {
+		return err
+	}
+
+	newCount := 0
+	if new {
+		if !s.conf.DisableTopoIndex {
+			if s.conf.LazyTopoIndex {
+				//the [topo_index] => [event hash] write is deferred below,
+				//after the commit, like dbSetEvents does
+			} else {
+				//insert [topo_index] => [event hash]
+				if err := tx.Set(topologicalEventKey(topoIndex), []byte(hash)); err != nil {
+					return err
+				}
+			}
+			//insert [event hash] => [topo_index] reverse mapping
+			if err := tx.Set(hashTopoKey(hash), []byte(strconv.Itoa(topoIndex))); err != nil {
+				return err
+			}
+			newCount++
+		}
+		if !s.conf.DisableParticipantIndex {
+			//insert [participant_index] => [event hash]
+			if err := tx.Set(participantEventKey(creator, participantIndex), []byte(hash)); err != nil {
+				return err
+			}
+		}
+		//insert [parent hash] => [child hash] reverse links
+		for _, parent := range comet.Body.Parents {
+			if parent == "" {
+				continue
+			}
+			if err := tx.Set(childKey(parent, hash), []byte(hash)); err != nil {
+				return err
+			}
+		}
+		//insert [time_nanos_hash] => [event hash] for time-range scans
+		if err := tx.Set(timeKey(comet.Body.Timestamp.UnixNano(), hash), []byte(hash)); err != nil {
+			return err
+		}
+	}
+	//round-received is usually assigned on a later re-store of an existing
+	//event, so this index is maintained outside the new guard
+	if comet.RoundReceived != nil {
+		if err := tx.Set(roundReceivedKey(*comet.RoundReceived, hash), []byte(hash)); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(nil); err != nil {
+		return err
+	}
+	if new {
+		s.metrics.dedup(1, 0)
+	} else {
+		s.metrics.dedup(0, 1)
+	}
+	if new && s.conf.LazyTopoIndex && !s.conf.DisableTopoIndex {
+		s.pendingTopoLock.Lock()
+		if s.pendingTopo == nil {
+			s.pendingTopo = make(map[int]string)
+		}
+		s.pendingTopo[topoIndex] = hash
+		full := len(s.pendingTopo) >= lazyTopoFlushThreshold
+		s.pendingTopoLock.Unlock()
+		if full {
+			if err := s.flushTopoIndex(); err != nil {
+				return err
+			}
+		}
+	}
+	//keep the cached counters current once they are seeded, like dbSetEvents
+	if newCount > 0 {
+		for {
+			c := atomic.LoadInt64(&s.eventsCount)
+			if c < 0 || atomic.CompareAndSwapInt64(&s.eventsCount, c, c+int64(newCount)) {
+				break
+			}
+		}
+		for {
+			m := atomic.LoadInt64(&s.maxTopoIndex)
+			if m == -2 || int64(topoIndex) <= m ||
+				atomic.CompareAndSwapInt64(&s.maxTopoIndex, m, int64(topoIndex)) {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func (s *BadgerStore) ParticipantEvents(participant string, skip int) ([]string, error) {
+	res, err := s.inmemStore.ParticipantEvents(participant, skip)
+	if err != nil {
+		res, err = s.dbParticipantEvents(participant, skip)
+	}
+	return res, err
+}
+
+func (s *BadgerStore) ParticipantEvent(participant string, index int) (string, error) {
+	result, err := s.inmemStore.ParticipantEvent(participant, index)
+	if err != nil {
+		result, err = s.dbParticipantEvent(participant, index)
+	}
+	return result, mapError(err, string(participantEventKey(participant, index)))
+}
+
+//ParticipantEventsAfterHash returns the hashes of a participant's events that
+//come after afterHash, in index order. It is the anti-entropy primitive: a
+//peer advertises the last hash it holds and receives everything newer. An
+//empty afterHash means everything from index 0; a hash that is unknown or
+//belongs to another participant yields an errors.KeyNotFound error.
+func (s *BadgerStore) ParticipantEventsAfterHash(participant, afterHash string) ([]string, error) {
+	if afterHash == "" {
+		return s.ParticipantEvents(participant, -1)
+	}
+	comet, err := s.GetComet(afterHash)
+	if err != nil {
+		return nil, err
+	}
+	if comet.Creator() != participant {
+		return nil, errors.NewStoreErr(errors.KeyNotFound, afterHash)
+	}
+	return s.ParticipantEvents(participant, comet.Index())
+}
+
+func (s *BadgerStore) LastEventFrom(participant string) (last string, isRoot bool, err error) {
+	last, isRoot, err = s.inmemStore.LastEventFrom(participant)
+	if err != nil || !isRoot {
+		return last, isRoot, err
+	}
+	//cold cache: the in-memory window is empty but the db may know better
+	index, found, dbErr := s.participantLastIndex(participant)
+	if dbErr != nil || !found {
+		return last, isRoot, err
+	}
+	hash, dbErr := s.dbParticipantEvent(participant, index)
+	if dbErr != nil {
+		return last, isRoot, err
+	}
+	return hash, false, nil
+}
+
+//participantLastIndex finds the highest index present in a participant's
+//event index with a reverse key-only seek, so a participant's head can be
+//recovered without scanning the whole history. false means the participant
+//has no indexed events.
+func (s *BadgerStore) participantLastIndex(participant string) (int, bool, error) {
+	if s.conf.DisableParticipantIndex {
+		return -1, false, errors.NewStoreErr(errors.IndexDisabled, participant)
+	}
+	index := -1
+	found := false
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Reverse = true
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		prefix := []byte(fmt.Sprintf("%s__event_", participant))
+		//seek past the last index key and walk backwards
+		seek := append(append([]byte{}, prefix...), 0xFF)
+		it.Seek(seek)
+		if !it.ValidForPrefix(prefix) {
+			return nil
+		}
+		key := string(it.Item().Key())
+		i, err := strconv.Atoi(key[len(prefix):])
+		if err != nil {
+			return errors.NewStoreErr(errors.DecodeError, key)
+		}
+		index = i
+		found = true
+		return nil
+	})
+	if err != nil {
+		return -1, false, err
+	}
+	return index, found, nil
+}
+
+func (s *BadgerStore) KnownEvents() map[int]int {
+	participants, _ := s.Participants()
+	known := make(map[int]int)
+	for p, pid := range participants {
+		index := -1
+		last, isRoot, err := s.LastEventFrom(p)
+		s.logger.Info().Str("participant", p).Bool("isRoot", isRoot).Str("lastKet", last).Msg("KnownEvents:LastEventFrom")
+		if err == nil {
+			if isRoot {
+				root, err := s.GetRoot(p)
+				s.logger.Info().Str("participant", p).Bool("isRoot", isRoot).Int("rootIndex", root.Index).Msg("KnownEvents:GetRoot")
+				if err != nil {
+					last = root.X
+					index = root.Index
+				}
+			} else {
+				lastEvent, err := s.GetComet(last)
+				s.logger.Info().Str("participant", p).Bool("isRoot", isRoot).Int("eventIndex", lastEvent.Index()).Msg("KnownEvents:GetComet")
+				if err == nil {
+					index = lastEvent.Index()
+				}
+			}
+
+		}
+		known[pid] = index
+	}
+	return known
+}
+
+func (s *BadgerStore) ConsensusEvents() []string {
+	return s.inmemStore.ConsensusEvents()
+}
+
+//ConsensusEventsCount falls back to the persisted count when the in-memory
+//list is empty, so a restarted node does not report zero consensus events
+func (s *BadgerStore) ConsensusEventsCount() int {
+	if c := s.inmemStore.ConsensusEventsCount(); c > 0 {
+		return c
+	}
+	c, err := s.dbConsensusEventsCount()
+	if err != nil {
+		return 0
+	}
+	return c
+}
+
+func (s *BadgerStore) AddConsensusEvent(key string) error {
+	if s.consensusIndex < 0 {
+		s.consensusIndex = s.ConsensusEventsCount()
+	}
+	if err := s.inmemStore.AddConsensusEvent(key); err != nil {
+		return err
+	}
+	if err := s.kvPut(consensusEventKey(s.consensusIndex), []byte(key)); err != nil {
+		return err
+	}
+	s.consensusIndex++
+	return nil
+}
+
+//ConsensusComets returns the decoded consensus events for the position
+//window [from, to], in consensus order, read from the persisted consensus
+//list. The window is clamped to the stored range, so an out-of-range request
+//returns what exists rather than failing. Hashes whose events cannot be
+//found are collected into an aggregated error alongside the partial result.
+func (s *BadgerStore) ConsensusComets(from, to int) ([]types.Comet, error) {
+	total, err := s.dbConsensusEventsCount()
+	if err != nil {
+		return nil, err
+	}
+	if from < 0 {
+		from = 0
+	}
+	if to >= total {
+		to = total - 1
+	}
+	res := []types.Comet{}
+	missing := []string{}
+	for i := from; i <= to; i++ {
+		v, err := s.kvGet(consensusEventKey(i))
+		if err != nil {
+			return res, mapError(err, string(consensusEventKey(i)))
+		}
+		comet, err := s.GetComet(string(v))
+		if err != nil {
+			missing = append(missing, string(v))
+			continue
+		}
+		res = append(res, comet)
+	}
+	if len(missing) > 0 {
+		return res, fmt.Errorf("consensus positions %d-%d missing events: %v", from, to, missing)
+	}
+	return res, nil
+}
+
+//DeleteConsensusEventsFrom removes persisted consensus entries at and after
+//index and truncates the in-memory list to match, so the order can be rebuilt
+//when a late-arriving event changes it.
+func (s *BadgerStore) DeleteConsensusEventsFrom(index int) error {
+	if index < 0 {
+		index = 0
+	}
+	count := s.ConsensusEventsCount()
+	//delete in batches like deleteKeysWithPrefix, so a large rollback stays
+	//below badger's transaction size limit instead of hitting ErrTxnTooBig
+	for start := index; start < count; start += 1000 {
+		end := start + 1000
+		if end > count {
+			end = count
+		}
+		tx := s.db.NewTransaction(true)
+		for i := start; i < end; i++ {
+			if err := tx.Delete(consensusEventKey(i)); err != nil {
+				tx.Discard()
+				return err
+			}
+		}
+		if err := tx.Commit(nil); err != nil {
+			return err
+		}
+	}
+	if err := s.inmemStore.TruncateConsensusEvents(index); err != nil {
+		return err
+	}
+	if s.consensusIndex > index {
+		s.consensusIndex = index
+	}
+	return nil
+}
+
+//GetRound reads the cached round first and falls back to the db. The cache
+//is the round mutators' publication point: AddRoundWitness/AddRoundEvent
+//refresh it with the merged value after their commit and before returning,
+//all under the same mutation lock, so once such a call has returned its
+//addition is visible to every subsequent GetRound. An in-flight mutation is
+//not visible until its commit.
+func (s *BadgerStore) GetRound(r int) (types.RoundInfo, error) {
+	res, err := s.inmemStore.GetRound(r)
+	cacheHit := err == nil
+	if err != nil {
+		res, err = s.dbGetRound(r)
+	}
+	s.metrics.read(cacheHit, err)
+	return res, mapError(err, string(roundKey(r)))
+}
+
+func (s *BadgerStore) SetRound(r int, round types.RoundInfo) error {
+	if err := s.inmemStore.SetRound(r, round); err != nil {
+		return err
+	}
+	s.acquireWrite()
+	err := s.dbSetRound(r, round)
+	s.releaseWrite() //the watermark Put below takes its own slot
+	s.metrics.write(err)
+	if err != nil {
+		return err
+	}
+	if round.WitnessesDecided() {
+		s.advanceUndecidedWatermark(r)
+	}
+	s.mirrorRound(r, round)
+	return nil
+}
+
+//GetRoundBytes returns the raw RoundInfo blob under roundKey(r), with no
+//decode pass. Relay nodes forward rounds without inspecting them, so the
+//decode/encode cycle of GetRound is wasted CPU there.
+func (s *BadgerStore) GetRoundBytes(r int) ([]byte, error) {
+	var data []byte
+	key := roundKey(r)
+	err := s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(key)
+		if err != nil {
+			return err
+		}
+		data, err = item.ValueCopy(nil)
+		return err
+	})
+	if err != nil {
+		return nil, mapError(err, string(key))
+	}
+	return data, nil
+}
+
+//SetRoundBytes is the write-side counterpart of GetRoundBytes: it stores a
+//relayed RoundInfo blob under the same roundKey layout without decoding it.
+//The cached copy for that round is evicted so a later typed GetRound reads
+//the relayed bytes instead of a stale decode.
+func (s *BadgerStore) SetRoundBytes(r int, data []byte) error {
+	s.acquireWrite()
+	defer s.releaseWrite()
+	tx := s.db.NewTransaction(true)
+	defer tx.Discard()
+	if err := tx.Set(roundKey(r), data); err != nil {
+		return err
+	}
+	err := tx.Commit(nil)
+	s.metrics.write(err)
+	if err != nil {
+		return err
+	}
+	s.inmemStore.roundCache.Remove(r)
+	return nil
+}
+
+//update runs fn inside a single read-write transaction. Multi-key
+//read-modify-writes hit badger's ErrConflict under contention, and callers
+//should not hand-roll retry loops, so a conflicted commit re-runs fn with a
+//short backoff for up to MaxConflictRetries attempts. fn is assumed
+//idempotent.
+func (s *BadgerStore) update(fn func(kvTxn) error) error {
+	attempts := s.conf.MaxConflictRetries
+	if attempts <= 0 {
+		attempts = 5
+	}
+	var err error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			time.Sleep(time.Millisecond << uint(i-1))
+		}
+		err = s.kv.Update(fn)
+		if err != badger.ErrConflict {
+			return err
+		}
+	}
+	return err
+}
+
+//AddRoundWitness merges a single witness into a round. Unlike SetRound,
+//which replaces the whole RoundInfo and lets concurrent writers clobber each
+//other, this performs the read-modify-write inside one Update transaction
+//and retries on commit conflicts, so concurrent additions all survive.
+func (s *BadgerStore) AddRoundWitness(r int, witness string) error {
+	return s.mutateRound(r, func(round *types.RoundInfo) {
+		round.AddEvent(witness, true)
+	})
+}
+
+//AddRoundEvent is the non-witness counterpart of AddRoundWitness
+func (s *BadgerStore) AddRoundEvent(r int, event string) error {
+	return s.mutateRound(r, func(round *types.RoundInfo) {
+		round.AddEvent(event, false)
+	})
+}
+
+func (s *BadgerStore) mutateRound(r int, mutate func(*types.RoundInfo)) error {
+	s.roundMutateLock.Lock()
+	defer s.roundMutateLock.Unlock()
+	s.acquireWrite()
+	defer s.releaseWrite()
+
+	key := roundKey(r)
+	var round *types.RoundInfo
+	//update() re-runs the closure with backoff when the commit conflicts:
+	//a concurrent SetRound slipped in and the merge is retried against its
+	//result, giving up after MaxConflictRetries
+	err := s.update(func(txn kvTxn) error {
+		round = types.NewRoundInfo()
+		v, err := txn.Get(key)
+		if err == nil {
+			if err := round.Unmarshal(v); err != nil {
+				return errors.NewStoreErr(errors.DecodeError, string(key))
+			}
+		} else if !isDBKeyNotFound(err) {
+			return err
+		}
+		mutate(round)
+		val, err := round.Marshal()
+		if err != nil {
+			return err
+		}
+		return txn.Set(key, val)
+	})
+	s.metrics.write(err)
+	if err != nil {
+		return err
+	}
+
+	//refresh the cache with the merged value only after the commit and
+	//before releasing the mutation lock: this is what lets GetRound promise
+	//that a completed addition is never lost to a stale cached round
+	return s.inmemStore.SetRound(r, *round)
+}
+
+//FirstUndecidedRound returns the index of the first round at or after `from`
+//whose witnesses are not all decided, starting from the persisted watermark
+//when it is further along. If every stored round is decided, the index after
+//the last round is returned.
+func (s *BadgerStore) FirstUndecidedRound(from int) (int, error) {
+	r := s.undecidedWatermark()
+	if from > r {
+		r = from
+	}
+	last := s.LastRound()
+	for ; r <= last; r++ {
+		round, err := s.GetRound(r)
+		if err != nil {
+			return r, err
+		}
+		if !round.WitnessesDecided() {
+			return r, nil
+		}
+	}
+	return r, nil
+}
+
+func (s *BadgerStore) undecidedWatermark() int {
+	v, err := s.kvGet(undecidedWatermarkKey)
+	if err != nil {
+		return 0
+	}
+	w, err := strconv.Atoi(string(v))
+	if err != nil {
+		return 0
+	}
+	return w
+}
+
+//advanceUndecidedWatermark pushes the watermark past consecutive decided
+//rounds, starting at the round that was just decided
+func (s *BadgerStore) advanceUndecidedWatermark(r int) {
+	w := s.undecidedWatermark()
+	if r != w {
+		return
+	}
+	last := s.LastRound()
+	for w <= last {
+		round, err := s.GetRound(w)
+		if err != nil || !round.WitnessesDecided() {
+			break
+		}
+		w++
+	}
+	if err := s.kvPut(undecidedWatermarkKey, []byte(strconv.Itoa(w))); err != nil {
+		s.logger.Warn().Err(err).Msg("advanceUndecidedWatermark")
+	}
+}
+
+func (s *BadgerStore) LastRound() int {
+	return s.inmemStore.LastRound()
+}
+
+//MaxKnownRound returns the highest round index present in the store, using
+//whichever is larger of the cached LastRound and a reverse scan of the round
+//keys. Unlike LastRound it is correct on a cold load, where the InmemStore
+//has not seen any SetRound yet. -1 means no round exists at all.
+func (s *BadgerStore) MaxKnownRound() (int, error) {
+	max := s.LastRound()
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Reverse = true
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		prefix := []byte(roundPrefix + "_")
+		//seek past the last round key and walk backwards
+		seek := append(append([]byte{}, prefix...), 0xFF)
+		it.Seek(seek)
+		if !it.ValidForPrefix(prefix) {
+			return nil
+		}
+		key := string(it.Item().Key())
+		index, err := strconv.Atoi(key[len(prefix):])
+		if err != nil {
+			return errors.NewStoreErr(errors.DecodeError, key)
+		}
+		if index > max {
+			max = index
+		}
+		return nil
+	})
+	if err != nil {
+		return -1, err
+	}
+	return max, nil
+}
+
+//HeadInfo is the sync handshake payload sent to a freshly connecting peer:
+//the latest block, the last round and a copy of the current root set.
+type HeadInfo struct {
+	Block     types.Block
+	LastRound int
+	Round     types.RoundInfo
+	Roots     map[string]types.Root
+}
+
+//maxIndexUnder reverse-seeks the highest numeric index stored under
+//prefix+"_" within txn. -1 means no key exists under the prefix.
+func maxIndexUnder(txn *badger.Txn, prefix string) (int, error) {
+	opts := badger.DefaultIteratorOptions
+	opts.Reverse = true
+	opts.PrefetchValues = false
+	it := txn.NewIterator(opts)
+	defer it.Close()
+	p := []byte(prefix + "_")
+	//seek past the last key under the prefix and walk backwards
+	seek := append(append([]byte{}, p...), 0xFF)
+	it.Seek(seek)
+	if !it.ValidForPrefix(p) {
+		return -1, nil
+	}
+	key := string(it.Item().Key())
+	index, err := strconv.Atoi(key[len(p):])
+	if err != nil {
+		return -1, errors.NewStoreErr(errors.DecodeError, key)
+	}
+	return index, nil
+}
+
+//Head captures the store's head with all db reads served from one badger
+//snapshot (see ReadTxn), so a concurrent writer cannot tear the summary
+//across separate transactions. The head block and round are located within
+//that same snapshot. The ReadTxn getters do consult the cache first, so an
+//individual entry may be fresher than the snapshot, but never older. When
+//no block or round exists yet the corresponding fields are left at their
+//zero value and LastRound is -1.
+func (s *BadgerStore) Head() (HeadInfo, error) {
+	head := HeadInfo{
+		LastRound: -1,
+		Roots:     make(map[string]types.Root),
+	}
+	participants, err := s.Participants()
+	if err != nil {
+		return head, err
+	}
+	err = s.View(func(r ReadTxn) error {
+		lastBlock, err := maxIndexUnder(r.txn, blockPrefix)
+		if err != nil {
+			return err
+		}
+		if lastBlock >= 0 {
+			block, err := r.GetBlock(lastBlock)
+			if err != nil {
+				return err
+			}
+			head.Block = block
+		}
+
+		lastRound, err := maxIndexUnder(r.txn, roundPrefix)
+		if err != nil {
+			return err
+		}
+		head.LastRound = lastRound
+		if lastRound >= 0 {
+			round, err := r.GetRound(lastRound)
+			if err != nil {
+				return err
+			}
+			head.Round = round
+		}
+
+		for p := range participants {
+			root, err := r.GetRoot(p)
+			if err != nil {
+				return err
+			}
+			head.Roots[p] = root
+		}
+		return nil
+	})
+	return head, err
+}
+
+//Summary returns a one-line description of the store for startup/shutdown
+//logs: participant count, last round, last block, total events and db size.
+//A failing sub-query degrades to a "?" placeholder instead of failing the
+//whole summary, so it is always safe to log.
+func (s *BadgerStore) Summary() (string, error) {
+	participantCount := "?"
+	if participants, err := s.Participants(); err == nil {
+		participantCount = strconv.Itoa(len(participants))
+	}
+	lastRound := "?"
+	if r, err := s.MaxKnownRound(); err == nil {
+		lastRound = strconv.Itoa(r)
+	}
+	lastBlock := "?"
+	if blocks, err := s.LastNBlocks(1); err == nil {
+		if len(blocks) == 0 {
+			lastBlock = "-1"
+		} else {
+			lastBlock = strconv.Itoa(blocks[0].Index())
+		}
+	}
+	events := "?"
+	if c, err := s.EventsCount(); err == nil {
+		events = strconv.Itoa(c)
+	}
+	lsm, vlog := s.db.Size()
+	return fmt.Sprintf("participants=%s lastRound=%s lastBlock=%s events=%s dbSize=%d",
+		participantCount, lastRound, lastBlock, events, lsm+vlog), nil
+}
+
+//OrderedConsensusEvents returns the consensus events whose round-received
+//falls within [fromRound, toRound], sorted by the canonical consensus order:
+//round received, then consensus timestamp, then hash. Events that have not
+//reached consensus (no round-received) are not indexed and so never appear.
+//Only the requested window of the round-received index is scanned; the cost
+//is proportional to the events returned, not the store size.
+func (s *BadgerStore) OrderedConsensusEvents(fromRound, toRound int) ([]types.Comet, error) {
+	res := []types.Comet{}
+	if toRound < fromRound {
+		return res, nil
+	}
+	hashes := []string{}
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		prefix := []byte(rrPrefix + "_")
+		seek := []byte(fmt.Sprintf("%s_%09d_", rrPrefix, fromRound))
+		for it.Seek(seek); it.ValidForPrefix(prefix); it.Next() {
+			key := string(it.Item().Key())
+			rr, err := strconv.Atoi(key[len(prefix) : len(prefix)+9])
+			if err != nil {
+				continue
+			}
+			if rr > toRound {
+				break
+			}
+			hashes = append(hashes, key[len(prefix)+10:])
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range hashes {
+		ev, err := s.GetComet(h)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, ev)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if *res[i].RoundReceived != *res[j].RoundReceived {
+			return *res[i].RoundReceived < *res[j].RoundReceived
+		}
+		if !res[i].ConsensusTimestamp.Equal(res[j].ConsensusTimestamp) {
+			return res[i].ConsensusTimestamp.Before(res[j].ConsensusTimestamp)
+		}
+		return res[i].Hex() < res[j].Hex()
+	})
+
+	return res, nil
+}
+
+//EventsForBlock returns the events assigned a single round-received, in the
+//canonical (round-received, consensus timestamp, hash) order the block
+//builder consumes. A round-received with no events yields an empty slice.
+func (s *BadgerStore) EventsForBlock(roundReceived int) ([]types.Comet, error) {
+	return s.OrderedConsensusEvents(roundReceived, roundReceived)
+}
+
+//RoundEventComets returns the decoded events of a round in a stable
+//(lexicographic) order. Missing events are collected into a single
+//aggregated error, alongside the events that could be read.
+func (s *BadgerStore) RoundEventComets(r int) ([]types.Comet, error) {
+	round, err := s.GetRound(r)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make([]string, 0, len(round.Events))
+	for h := range round.Events {
+		hashes = append(hashes, h)
+	}
+	sort.Strings(hashes)
+
+	res := make([]types.Comet, 0, len(hashes))
+	missing := []string{}
+	for _, h := range hashes {
+		comet, err := s.GetComet(h)
+		if err != nil {
+			missing = append(missing, h)
+			continue
+		}
+		res = append(res, comet)
+	}
+
+	if len(missing) > 0 {
+		return res, fmt.Errorf("round %d missing events: %v", r, missing)
+	}
+	return res, nil
+}
+
+//ForEachRoundEvent streams a round's decoded events to fn in the same
+//stable (lexicographic) order as RoundEventComets, without materializing
+//the whole round: events are fetched in fixed-size batches over one shared
+//read transaction each, so memory stays bounded on huge rounds. An error
+//from fn aborts the walk and is propagated, except for ErrStopIteration
+//which just ends it.
+func (s *BadgerStore) ForEachRoundEvent(r int, fn func(types.Comet) error) error {
+	round, err := s.GetRound(r)
+	if err != nil {
+		return err
+	}
+
+	hashes := make([]string, 0, len(round.Events))
+	for h := range round.Events {
+		hashes = append(hashes, h)
+	}
+	sort.Strings(hashes)
+
+	const batchSize = 100
+	for start := 0; start < len(hashes); start += batchSize {
+		end := start + batchSize
+		if end > len(hashes) {
+			end = len(hashes)
+		}
+		err := s.View(func(rt ReadTxn) error {
+			for _, h := range hashes[start:end] {
+				comet, err := rt.GetComet(h)
+				if err != nil {
+					return err
+				}
+				if err := fn(comet); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err == ErrStopIteration {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//IsWitness reports whether an event is a witness of the round it belongs
+//to, walking the known rounds newest-first until the event's round entry is
+//found. An unknown event yields a typed errors.KeyNotFound error; a stored
+//event not yet assigned to any round is simply not a witness.
+func (s *BadgerStore) IsWitness(hash string) (bool, error) {
+	if _, err := s.GetComet(hash); err != nil {
+		return false, err
+	}
+	max, err := s.MaxKnownRound()
+	if err != nil {
+		return false, err
+	}
+	for r := max; r >= 0; r-- {
+		round, err := s.GetRound(r)
+		if err != nil {
+			if errors.Is(err, errors.KeyNotFound) {
+				continue
+			}
+			return false, err
+		}
+		if e, ok := round.Events[hash]; ok {
+			return e.Witness, nil
+		}
+	}
+	return false, nil
+}
+
+//RoundDecided returns whether all the witnesses of a round have their fame
+//decided. A missing round counts as not-decided and carries the typed
+//KeyNotFound error.
+func (s *BadgerStore) RoundDecided(r int) (bool, error) {
+	round, err := s.GetRound(r)
+	if err != nil {
+		return false, err
+	}
+	return round.WitnessesDecided(), nil
+}
+
+func (s *BadgerStore) RoundWitnesses(r int) []string {
+	round, err := s.GetRound(r)
+	if err != nil {
+		return []string{}
+	}
+	return round.Witnesses()
+}
+
+//WitnessState pairs a round witness with its fame decision state
+type WitnessState struct {
+	Hash    string
+	Decided bool
+	Famous  bool
+}
+
+//RoundWitnessStates returns a round's witnesses together with whether each
+//fame vote has been decided and its outcome, sorted by hash, so dashboard
+//callers do not have to dig into RoundInfo internals. A missing round yields
+//an errors.KeyNotFound error.
+func (s *BadgerStore) RoundWitnessStates(r int) ([]WitnessState, error) {
+	round, err := s.GetRound(r)
+	if err != nil {
+		return nil, err
+	}
+	res := []WitnessState{}
+	for _, hash := range round.Witnesses() {
+		e := round.Events[hash]
+		res = append(res, WitnessState{
+			Hash:    hash,
+			Decided: e.Famous != types.Undefined,
+			Famous:  e.Famous == types.True,
+		})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Hash < res[j].Hash })
+	return res, nil
+}
+
+func (s *BadgerStore) RoundEvents(r int) int {
+	round, err := s.GetRound(r)
+	if err != nil {
+		return 0
+	}
+	return len(round.Events)
+}
+
+func (s *BadgerStore) GetRoot(participant string) (types.Root, error) {
+	root, err := s.inmemStore.GetRoot(participant)
+	if err != nil {
+		root, err = s.dbGetRoot(participant)
+	}
+	return root, mapError(err, string(participantRootKey(participant)))
+}
+
+//GenesisRoot returns the root a participant was created with, as recorded
+//by dbSetGenesisRoots when the store (or the participant) was first set up.
+//Resets advance the working root returned by GetRoot; the genesis root never
+//moves, so it is what to check when verifying a node started from the right
+//genesis.
+func (s *BadgerStore) GenesisRoot(participant string) (types.Root, error) {
+	key := genesisRootKey(participant)
+	data, err := s.kvGet(key)
+	if err != nil {
+		return types.Root{}, mapError(err, string(key))
+	}
+	root := new(types.Root)
+	if err := root.Unmarshal(data); err != nil {
+		return types.Root{}, errors.NewStoreErr(errors.DecodeError, string(key))
+	}
+	return *root, nil
+}
+
+//RootsFor returns the roots of just the requested participants, serving
+//cache hits first and batching the remaining reads in a single db View.
+//Unknown participants are aggregated into one error, alongside the roots
+//that were found.
+func (s *BadgerStore) RootsFor(participants []string) (map[string]types.Root, error) {
+	res := make(map[string]types.Root, len(participants))
+	remaining := []string{}
+	for _, p := range participants {
+		if root, err := s.inmemStore.GetRoot(p); err == nil {
+			res[p] = root
+		} else {
+			remaining = append(remaining, p)
+		}
+	}
+
+	if len(remaining) > 0 {
+		err := s.db.View(func(txn *badger.Txn) error {
+			for _, p := range remaining {
+				item, err := txn.Get(participantRootKey(p))
+				if err != nil {
+					if isDBKeyNotFound(err) {
+						continue
+					}
+					return err
+				}
+				v, err := item.ValueCopy(nil)
+				if err != nil {
+					return err
+				}
+				root := new(types.Root)
+				if err := root.Unmarshal(v); err != nil {
+					return errors.NewStoreErr(errors.DecodeError, string(participantRootKey(p)))
+				}
+				res[p] = *root
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	missing := []string{}
+	for _, p := range participants {
+		if _, ok := res[p]; !ok {
+			missing = append(missing, p)
+		}
+	}
+	if len(missing) > 0 {
+		return res, fmt.Errorf("unknown participants: %v", missing)
+	}
+	return res, nil
+}
+
+//RootParentComets returns the decoded events a participant's root is built
+//from: X, Y, then the Others references in a stable (lexicographic) order.
+//Base roots with empty references yield an empty slice. Missing parents are
+//collected into a single aggregated error, alongside the events that could
+//be read.
+func (s *BadgerStore) RootParentComets(participant string) ([]types.Comet, error) {
+	root, err := s.GetRoot(participant)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := []string{}
+	seen := map[string]bool{}
+	appendHash := func(h string) {
+		if h == "" || seen[h] {
+			return
+		}
+		seen[h] = true
+		hashes = append(hashes, h)
+	}
+	appendHash(root.X)
+	appendHash(root.Y)
+
+	others := make([]string, 0, len(root.Others))
+	for _, h := range root.Others {
+		others = append(others, h)
+	}
+	sort.Strings(others)
+	for _, h := range others {
+		appendHash(h)
+	}
+
+	res := make([]types.Comet, 0, len(hashes))
+	missing := []string{}
+	for _, h := range hashes {
+		comet, err := s.GetComet(h)
+		if err != nil {
+			missing = append(missing, h)
+			continue
+		}
+		res = append(res, comet)
+	}
+
+	if len(missing) > 0 {
+		return res, fmt.Errorf("root %s missing parent events: %v", participant, missing)
+	}
+	return res, nil
+}
+
+//RootIndex returns just the index of a participant's root. KnownEvents only
+//needs that one int, so this skips copying the full Root when the cached
+//copy is available and falls back to a single db read otherwise.
+func (s *BadgerStore) RootIndex(participant string) (int, error) {
+	if root, err := s.inmemStore.GetRoot(participant); err == nil {
+		return root.Index, nil
+	}
+	root, err := s.dbGetRoot(participant)
+	if err != nil {
+		return -1, mapError(err, string(participantRootKey(participant)))
+	}
+	return root.Index, nil
+}
+
+func (s *BadgerStore) GetBlock(rr int) (types.Block, error) {
+	res, err := s.inmemStore.GetBlock(rr)
+	cacheHit := err == nil
+	if err != nil {
+		res, err = s.dbGetBlock(rr)
+	}
+	s.metrics.read(cacheHit, err)
+	return res, mapError(err, string(blockKey(rr)))
+}
+
+func (s *BadgerStore) SetBlock(block types.Block) error {
+	if s.conf.StrictBlockOrder {
+		if err := s.checkBlockOrder(block.Index()); err != nil {
+			return err
+		}
+	}
+	if err := s.inmemStore.SetBlock(block); err != nil {
+		return err
+	}
+	if err := s.crashPoint("setblock:pre-db"); err != nil {
+		return err
+	}
+	s.acquireWrite()
+	defer s.releaseWrite()
+	err := s.dbSetBlock(block)
+	s.metrics.write(err)
+	if err == nil {
+		if s.conf.StrictBlockOrder {
+			s.blockIndexLock.Lock()
+			s.lastBlockIndex = int64(block.Index())
+			s.blockIndexLock.Unlock()
+		}
+		s.mirrorBlock(block)
+	}
+	return err
+}
+
+//checkBlockOrder enforces StrictBlockOrder: the incoming index must be
+//exactly one past the last stored block. The watermark is seeded lazily from
+//the db so strict mode also works on reopened stores; an empty store accepts
+//any first index.
+func (s *BadgerStore) checkBlockOrder(index int) error {
+	s.blockIndexLock.Lock()
+	defer s.blockIndexLock.Unlock()
+	if s.lastBlockIndex == -2 {
+		last, err := s.dbLastNBlocks(1)
+		if err != nil {
+			return err
+		}
+		if len(last) == 0 {
+			s.lastBlockIndex = -1
+		} else {
+			s.lastBlockIndex = int64(last[0].Index())
+		}
+	}
+	if s.lastBlockIndex >= 0 && int64(index) != s.lastBlockIndex+1 {
+		return errors.NewStoreErr(errors.NonContiguousBlock, string(blockKey(index)))
+	}
+	return nil
+}
+
+//GetBlockChecked is the stricter variant of GetBlock used when serving
+//blocks to peers: it reads the block from the db, recomputes its body hash
+//and compares it to the hash recorded by dbSetBlock, so silent on-disk
+//corruption surfaces as an errors.CorruptValue error instead of propagating.
+func (s *BadgerStore) GetBlockChecked(index int) (types.Block, error) {
+	block, err := s.dbGetBlock(index)
+	if err != nil {
+		return types.Block{}, mapError(err, string(blockKey(index)))
+	}
+	stored, err := s.kvGet(blockHashKey(index))
+	if err != nil {
+		return types.Block{}, mapError(err, string(blockHashKey(index)))
+	}
+	computed, err := block.Body.Hash()
+	if err != nil {
+		return types.Block{}, err
+	}
+	if !bytes.Equal(computed, stored) {
+		return types.Block{}, errors.NewStoreErr(errors.CorruptValue, string(blockKey(index)))
+	}
+	return block, nil
+}
+
+//AddBlockSignature persists one collected block signature under its own
+//[blocksig_index_validator] key. Signatures arrive one by one while a block
+//is gathering its quorum, so they are stored individually instead of
+//rewriting the whole block per signature; a repeated signature from the same
+//validator just overwrites its key.
+func (s *BadgerStore) AddBlockSignature(sig types.BlockSignature) error {
+	s.acquireWrite()
+	defer s.releaseWrite()
+	tx := s.db.NewTransaction(true)
+	defer tx.Discard()
+	if err := tx.Set(blockSigKey(sig.Index, sig.ValidatorHex()), []byte(sig.Signature)); err != nil {
+		return err
+	}
+	err := tx.Commit(nil)
+	s.metrics.write(err)
+	return err
+}
+
+//BlockSignatureCount counts the signatures collected for a block with a
+//key-only scan, no value decoding, so supermajority checks stay O(signatures)
+//however often they run.
+func (s *BadgerStore) BlockSignatureCount(blockIndex int) (int, error) {
+	count := 0
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		prefix := []byte(fmt.Sprintf("%s_%09d_", blockSigPrefix, blockIndex))
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			count++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+//DeleteBlocksFrom drops the contiguous tail of blocks starting at index
+//after a detected reorg: the block records, their blockhash and roundblock
+//index entries, and the cached copies. Blocks below index are left intact.
+//Returns how many blocks were deleted.
+func (s *BadgerStore) DeleteBlocksFrom(index int) (int, error) {
+	if index < 0 {
+		index = 0
+	}
+	s.acquireWrite()
+	defer s.releaseWrite()
+
+	//delete in batches so a deep reorg stays below badger's transaction
+	//size limit: each block removes three keys, so 333 blocks per
+	//transaction matches deleteKeysWithPrefix's 1000-key budget. On error
+	//the count of already-committed deletions is returned.
+	deleted := 0
+	for {
+		tx := s.db.NewTransaction(true)
+		n := 0
+		more := true
+		for n < 333 {
+			i := index + deleted + n
+			block, err := s.dbGetBlock(i)
+			if err != nil {
+				if isDBKeyNotFound(err) {
+					more = false
+					break
+				}
+				tx.Discard()
+				return deleted, mapError(err, string(blockKey(i)))
+			}
+			if err := tx.Delete(blockKey(i)); err != nil {
+				tx.Discard()
+				return deleted, err
+			}
+			if err := tx.Delete(blockHashKey(i)); err != nil {
+				tx.Discard()
+				return deleted, err
+			}
+			if err := tx.Delete(roundBlockKey(block.RoundReceived())); err != nil {
+				tx.Discard()
+				return deleted, err
+			}
+			n++
+		}
+		if n == 0 {
+			tx.Discard()
+			break
+		}
+		if err := tx.Commit(nil); err != nil {
+			return deleted, err
+		}
+		//evict the committed batch from the cache only after its commit
+		for i := index + deleted; i < index+deleted+n; i++ {
+			s.inmemStore.blockCache.Remove(i)
+		}
+		deleted += n
+		if !more {
+			break
+		}
+	}
+	if deleted == 0 {
+		return 0, nil
+	}
+	s.blockIndexLock.Lock()
+	if s.lastBlockIndex != -2 && s.lastBlockIndex >= int64(index) {
+		s.lastBlockIndex = int64(index) - 1
+	}
+	s.blockIndexLock.Unlock()
+	return deleted, nil
+}
+
+//BlockStateHash returns just the state hash a block carries: the
+//application state root after applying it, which is all the state machine
+//needs for verification. A missing block yields an errors.KeyNotFound
+//error.
+func (s *BadgerStore) BlockStateHash(index int) ([]byte, error) {
+	block, err := s.GetBlock(index)
+	if err != nil {
+		return nil, err
+	}
+	return block.StateHash(), nil
+}
+
+//SetLastApplied durably records the index of the last block the state
+//machine applied, so it can resume idempotently after a crash instead of
+//re-deriving its position from application state.
+func (s *BadgerStore) SetLastApplied(blockIndex int) error {
+	err := s.kv.Set(lastAppliedKey, []byte(strconv.Itoa(blockIndex)))
+	s.metrics.write(err)
+	return err
+}
+
+//LastApplied returns the marker written by SetLastApplied, or -1 when no
+//block has been applied yet.
+func (s *BadgerStore) LastApplied() (int, error) {
+	v, err := s.kvGet(lastAppliedKey)
+	if err != nil {
+		if isDBKeyNotFound(err) {
+			return -1, nil
+		}
+		return -1, err
+	}
+	index, err := strconv.Atoi(string(v))
+	if err != nil {
+		return -1, errors.NewStoreErr(errors.DecodeError, string(lastAppliedKey))
+	}
+	return index, nil
+}
+
+//BlockRound returns the round-received of a block, read from the block
+//itself. A missing block yields an errors.KeyNotFound error.
+func (s *BadgerStore) BlockRound(blockIndex int) (int, error) {
+	block, err := s.GetBlock(blockIndex)
+	if err != nil {
+		return -1, err
+	}
+	return block.RoundReceived(), nil
+}
+
+//RoundBlock is the reverse direction: the index of the block a round was
+//received in, maintained by dbSetBlock. A round without a block yields an
+//errors.KeyNotFound error.
+func (s *BadgerStore) RoundBlock(roundIndex int) (int, error) {
+	key := roundBlockKey(roundIndex)
+	val, err := s.kvGet(key)
+	if err != nil {
+		return -1, mapError(err, string(key))
+	}
+	index, err := strconv.Atoi(string(val))
+	if err != nil {
+		return -1, errors.NewStoreErr(errors.DecodeError, string(key))
+	}
+	return index, nil
+}
+
+//ReconstructBlock returns a block, rebuilding it from consensus data when
+//the block record itself is gone: the round<->block mapping locates the
+//round the block was received in, and the round's events are re-ordered
+//into the block's transaction list exactly as the original block builder
+//did. The rebuilt block is re-persisted so the next read is a plain
+//GetBlock, which is the self-healing path after a partial wipe. State hash
+//and signatures are not recoverable from rounds and come back empty.
+func (s *BadgerStore) ReconstructBlock(index int) (types.Block, error) {
+	block, err := s.GetBlock(index)
+	if err == nil {
+		return block, nil
+	}
+	if !errors.Is(err, errors.KeyNotFound) {
+		return types.Block{}, err
+	}
+
+	//find the round this block was received in via the reverse mapping
+	roundReceived := -1
+	err = s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		prefix := []byte(roundBlockPrefix + "_")
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			v, err := it.Item().Value()
+			if err != nil {
+				return err
+			}
+			blockIndex, err := strconv.Atoi(string(v))
+			if err != nil || blockIndex != index {
+				continue
+			}
+			key := string(it.Item().Key())
+			roundReceived, err = strconv.Atoi(key[len(prefix):])
+			if err != nil {
+				return errors.NewStoreErr(errors.DecodeError, key)
+			}
+			return nil
+		}
+		return nil
+	})
+	if err != nil {
+		return types.Block{}, err
+	}
+	if roundReceived < 0 {
+		return types.Block{}, errors.NewStoreErr(errors.KeyNotFound, string(blockKey(index)))
+	}
+
+	events, err := s.EventsForBlock(roundReceived)
+	if err != nil {
+		return types.Block{}, err
+	}
+	transactions := [][]byte{}
+	for _, ev := range events {
+		transactions = append(transactions, ev.Transactions()...)
+	}
+	block = types.NewBlock(index, roundReceived, transactions)
+
+	//re-persist so the store heals; the cache follows for coherent reads
+	if err := s.dbSetBlock(block); err != nil {
+		return types.Block{}, err
+	}
+	if err := s.inmemStore.SetBlock(block); err != nil {
+		return types.Block{}, err
+	}
+	return block, nil
+}
+
+//ErrStopIteration can be returned by a ForEachBlock callback to terminate
+//the walk early without surfacing an error
+var ErrStopIteration = fmt.Errorf("stop iteration")
+
+//ForEachBlock streams every persisted block in ascending index order,
+//decoding lazily one block at a time. A non-nil error from fn aborts the
+//walk and is propagated, except for ErrStopIteration which just ends it.
+func (s *BadgerStore) ForEachBlock(fn func(types.Block) error) error {
+	err := s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		prefix := []byte(blockPrefix + "_")
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			v, err := it.Item().Value()
+			if err != nil {
+				return err
+			}
+			block := new(types.Block)
+			if err := block.Unmarshal(v); err != nil {
+				return errors.NewStoreErr(errors.DecodeError, string(it.Item().Key()))
+			}
+			if err := fn(*block); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == ErrStopIteration {
+		return nil
+	}
+	return err
+}
+
+//GetManyBlocks fetches a set of (possibly non-contiguous) block indices,
+//serving cache hits first and batching the remaining reads in a single db
+//View. Blocks come back in the requested order; missing indices are
+//aggregated into one error alongside the blocks that were found.
+func (s *BadgerStore) GetManyBlocks(indices []int) ([]types.Block, error) {
+	found := make(map[int]types.Block, len(indices))
+	remaining := []int{}
+	for _, index := range indices {
+		if block, err := s.inmemStore.GetBlock(index); err == nil {
+			found[index] = block
+		} else {
+			remaining = append(remaining, index)
+		}
+	}
+
+	if len(remaining) > 0 {
+		err := s.db.View(func(txn *badger.Txn) error {
+			for _, index := range remaining {
+				item, err := txn.Get(blockKey(index))
+				if err != nil {
+					if isDBKeyNotFound(err) {
+						continue
+					}
+					return err
+				}
+				v, err := item.ValueCopy(nil)
+				if err != nil {
+					return err
+				}
+				block := new(types.Block)
+				if err := block.Unmarshal(v); err != nil {
+					return errors.NewStoreErr(errors.DecodeError, string(blockKey(index)))
+				}
+				found[index] = *block
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	res := make([]types.Block, 0, len(found))
+	missing := []int{}
+	for _, index := range indices {
+		block, ok := found[index]
+		if !ok {
+			missing = append(missing, index)
+			continue
+		}
+		res = append(res, block)
+	}
+
+	if len(missing) > 0 {
+		return res, fmt.Errorf("missing blocks: %v", missing)
+	}
+	return res, nil
+}
+
+//BlockHashes returns the hex hash of every block in [start, end], computed
+//from the decoded blocks. A gap aborts the scan with the typed KeyNotFound
+//error of the first missing index.
+func (s *BadgerStore) BlockHashes(start, end int) ([]string, error) {
+	res := []string{}
+	next := start
+	err := s.ForEachBlock(func(block types.Block) error {
+		if block.Index() < start {
+			return nil
+		}
+		if block.Index() != next {
+			return errors.NewStoreErr(errors.KeyNotFound, string(blockKey(next)))
+		}
+		res = append(res, block.Hex())
+		next++
+		if next > end {
+			return ErrStopIteration
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if next <= end {
+		return nil, errors.NewStoreErr(errors.KeyNotFound, string(blockKey(next)))
+	}
+	return res, nil
+}
+
+//LastNBlocks returns the n most recent blocks, newest-first. If fewer than n
+//blocks exist, all of them are returned. An empty store yields an empty slice.
+func (s *BadgerStore) LastNBlocks(n int) ([]types.Block, error) {
+	return s.dbLastNBlocks(n)
+}
+
+//Generation returns the persisted generation counter. Replicas tailing a
+//primary compare generations to detect a reset/truncation discontinuity and
+//invalidate their caches.
+func (s *BadgerStore) Generation() (uint64, error) {
+	v, err := s.kvGet(generationKey)
+	if err != nil {
+		if isDBKeyNotFound(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return strconv.ParseUint(string(v), 10, 64)
+}
+
+//Fingerprint digests the store's head state - generation counter,
+//participant set, highest known round and last block hash - into a short
+//hash, so two replicas can compare sync status without a full walk. Every
+//input is a point read or a single reverse seek, never a scan. Matching
+//fingerprints mean the stores are very likely identical at the head;
+//diverged histories below an identical head are not detected.
+func (s *BadgerStore) Fingerprint() ([]byte, error) {
+	var b bytes.Buffer
+
+	generation, err := s.Generation()
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(&b, "generation:%d\n", generation)
+
+	participants, err := s.Participants()
+	if err != nil {
+		return nil, err
+	}
+	pubKeys := make([]string, 0, len(participants))
+	for pk := range participants {
+		pubKeys = append(pubKeys, pk)
 	}
-	return res, mapError(err, string(blockKey(rr)))
+	sort.Strings(pubKeys)
+	for _, pk := range pubKeys {
+		fmt.Fprintf(&b, "participant:%s=%d\n", pk, participants[pk])
+	}
+
+	maxRound, err := s.MaxKnownRound()
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(&b, "round:%d\n", maxRound)
+
+	last, err := s.dbLastNBlocks(1)
+	if err != nil {
+		return nil, err
+	}
+	if len(last) > 0 {
+		fmt.Fprintf(&b, "block:%d=%s\n", last[0].Index(), last[0].Hex())
+	}
+
+	return crypto.SHA256(b.Bytes()), nil
 }
 
-func (s *BadgerStore) SetBlock(block types.Block) error {
-	if err := s.inmemStore.SetBlock(block); err != nil {
+func (s *BadgerStore) bumpGeneration() error {
+	g, err := s.Generation()
+	if err != nil {
 		return err
 	}
-	return s.dbSetBlock(block)
+	return s.kvPut(generationKey, []byte(strconv.FormatUint(g+1, 10)))
+}
+
+//FlushCache drops the cached comets, rounds and blocks so subsequent reads
+//are forced down the db fallback path. Roots, participants and the index
+//watermarks are kept, and nothing on disk is touched. This is a test barrier
+//for asserting disk correctness without a close/reopen cycle.
+func (s *BadgerStore) FlushCache() {
+	if s.writeBuf != nil {
+		s.writeBuf.drain()
+	}
+	s.inmemStore.FlushCache()
 }
 
+//Reset only resets the InmemStore and bumps the generation counter; the
+//badger db keeps its old derived entries. Use ResetStore when the on-disk
+//state must match the new roots.
 func (s *BadgerStore) Reset(roots map[string]types.Root) error {
+	if err := s.bumpGeneration(); err != nil {
+		return err
+	}
 	return s.inmemStore.Reset(roots)
 }
 
-func (s *BadgerStore) Close() error {
-	if err := s.inmemStore.Close(); err != nil {
+//ResetStore is the durable counterpart of Reset: in batched transactions it
+//drops the round, block, topological, consensus and participant-event index
+//entries that would contradict the new roots, persists those roots, resets
+//the InmemStore and bumps the generation counter.
+func (s *BadgerStore) ResetStore(roots map[string]types.Root) error {
+	prefixes := [][]byte{
+		[]byte(roundPrefix + "_"),
+		[]byte(blockPrefix + "_"),
+		[]byte(topoPrefix + "_"),
+		[]byte(consensusPrefix + "_"),
+		[]byte(hashTopoPrefix + "_"),
+		[]byte(roundBlockPrefix + "_"),
+		[]byte(childrenPrefix + "_"),
+		[]byte(blockSigPrefix + "_"),
+		[]byte(timePrefix + "_"),
+		[]byte(rrPrefix + "_"),
+	}
+	participants, err := s.Participants()
+	if err != nil {
+		return err
+	}
+	for p := range participants {
+		prefixes = append(prefixes, []byte(p+"__event_"))
+	}
+	for _, prefix := range prefixes {
+		if err := s.deleteKeysWithPrefix(prefix); err != nil {
+			return err
+		}
+	}
+
+	//the undecided watermark is derived data too
+	tx := s.db.NewTransaction(true)
+	if err := tx.Delete(undecidedWatermarkKey); err != nil {
+		tx.Discard()
 		return err
 	}
-	return s.db.Close()
+	if err := tx.Commit(nil); err != nil {
+		return err
+	}
+
+	if err := s.dbSetRoots(roots); err != nil {
+		return err
+	}
+	if err := s.inmemStore.Reset(roots); err != nil {
+		return err
+	}
+	//reseed the consensus append index and events count lazily; the
+	//unflushed topo tail refers to deleted events and is dropped with them
+	s.pendingTopoLock.Lock()
+	s.pendingTopo = nil
+	s.pendingTopoLock.Unlock()
+	s.depthCacheLock.Lock()
+	s.depthCache = nil
+	s.depthCacheLock.Unlock()
+	s.consensusIndex = -1
+	atomic.StoreInt64(&s.eventsCount, -1)
+	atomic.StoreInt64(&s.maxTopoIndex, -2)
+	if err := s.bumpGeneration(); err != nil {
+		return err
+	}
+	//re-pin against the surviving state; a wiped head simply pins nothing
+	return s.pinHotKeys()
+}
+
+//deleteKeysWithPrefix removes every key under prefix, batching deletes to
+//stay below badger's transaction size limit
+func (s *BadgerStore) deleteKeysWithPrefix(prefix []byte) error {
+	for {
+		keys := [][]byte{}
+		err := s.db.View(func(txn *badger.Txn) error {
+			opts := badger.DefaultIteratorOptions
+			opts.PrefetchValues = false
+			it := txn.NewIterator(opts)
+			defer it.Close()
+			for it.Seek(prefix); it.ValidForPrefix(prefix) && len(keys) < 1000; it.Next() {
+				keys = append(keys, it.Item().KeyCopy(nil))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if len(keys) == 0 {
+			return nil
+		}
+		tx := s.db.NewTransaction(true)
+		for _, key := range keys {
+			if err := tx.Delete(key); err != nil {
+				tx.Discard()
+				return err
+			}
+		}
+		if err := tx.Commit(nil); err != nil {
+			return err
+		}
+	}
+}
+
+//reservedPrefixes are the key namespaces used by the consensus store itself
+func reservedPrefixes() []string {
+	return []string{
+		participantPrefix,
+		rootSuffix,
+		roundPrefix,
+		topoPrefix,
+		blockPrefix,
+		consensusPrefix,
+		rootHistPrefix,
+		hashTopoPrefix,
+		roundBlockPrefix,
+		blockHashPrefix,
+		childrenPrefix,
+		blockSigPrefix,
+		genesisRootPrefix,
+		timePrefix,
+		rrPrefix,
+		participantWeightPrefix,
+		string(undecidedWatermarkKey),
+		string(lastAppliedKey),
+		string(generationKey),
+		string(codecKey),
+	}
+}
+
+//RegisterPrefix reserves a key namespace for application metadata living in
+//the same badger instance, e.g. the state machine's derived balances and
+//nonces. The name is checked against the consensus prefixes and previously
+//registered names; collisions return an error. The returned prefix is meant
+//to be prepended to keys used with Get/Put and manual iteration.
+func (s *BadgerStore) RegisterPrefix(name string) ([]byte, error) {
+	if name == "" {
+		return nil, fmt.Errorf("prefix name cannot be empty")
+	}
+	if strings.HasPrefix(name, "0x") {
+		return nil, fmt.Errorf("prefix %s collides with the event hash namespace", name)
+	}
+	//compare whole namespaces, not exact names: "round_000000001" lands
+	//inside the round_ keyspace and "rou" would swallow it, so either
+	//containment direction is a collision
+	nameNS := name + "_"
+	for _, reserved := range reservedPrefixes() {
+		reservedNS := reserved + "_"
+		if strings.HasPrefix(nameNS, reservedNS) || strings.HasPrefix(reservedNS, nameNS) {
+			return nil, fmt.Errorf("prefix %s collides with the reserved %s namespace", name, reserved)
+		}
+	}
+
+	s.appPrefixesLock.Lock()
+	defer s.appPrefixesLock.Unlock()
+	if _, ok := s.appPrefixes[name]; ok {
+		return nil, fmt.Errorf("prefix %s is already registered", name)
+	}
+	for registered := range s.appPrefixes {
+		registeredNS := registered + "_"
+		if strings.HasPrefix(nameNS, registeredNS) || strings.HasPrefix(registeredNS, nameNS) {
+			return nil, fmt.Errorf("prefix %s collides with the registered %s namespace", name, registered)
+		}
+	}
+	if s.appPrefixes == nil {
+		s.appPrefixes = make(map[string]struct{})
+	}
+	s.appPrefixes[name] = struct{}{}
+	return []byte(name + "_"), nil
+}
+
+func (s *BadgerStore) Close() error {
+	if s.gc != nil {
+		s.gc.close()
+	}
+	if s.writeBuf != nil {
+		s.writeBuf.close()
+	}
+	//a failed step must not abort the teardown: returning early would leak
+	//the remaining handles and hold badger's directory lock until the
+	//process exits. Every handle is closed and the first error is returned.
+	var first error
+	if s.conf.LazyTopoIndex {
+		if err := s.flushTopoIndex(); err != nil {
+			first = err
+		}
+	}
+	if err := s.inmemStore.Close(); err != nil && first == nil {
+		first = err
+	}
+	if s.metaDB != nil {
+		if err := s.metaDB.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	if err := s.db.Close(); err != nil && first == nil {
+		first = err
+	}
+	return first
 }
 
 //++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++
@@ -301,7 +2780,7 @@ func (s *BadgerStore) dbGetEvent(key string) (types.Comet, error) {
 		if err != nil {
 			return err
 		}
-		eventBytes, err = item.Value()
+		eventBytes, err = item.ValueCopy(nil)
 		return err
 	})
 
@@ -310,8 +2789,9 @@ func (s *BadgerStore) dbGetEvent(key string) (types.Comet, error) {
 	}
 
 	comet := new(types.Comet)
-	if err := comet.Unmarshal(eventBytes); err != nil {
-		return types.Comet{}, err
+	if err := s.codec.Unmarshal(eventBytes, comet); err != nil {
+		//present but undecodable: corruption, not absence
+		return types.Comet{}, errors.NewStoreErr(errors.DecodeError, key)
 	}
 
 	return *comet, nil
@@ -320,9 +2800,13 @@ func (s *BadgerStore) dbGetEvent(key string) (types.Comet, error) {
 func (s *BadgerStore) dbSetEvents(comets []types.Comet) error {
 	tx := s.db.NewTransaction(true)
 	defer tx.Discard()
+	newCount := 0
+	maxNewTopo := -1
+	written, skipped := 0, 0
+	lazyTopo := map[int]string{}
 	for _, comet := range comets {
 		cometHex := comet.Hex()
-		val, err := comet.Marshal()
+		val, err := s.codec.Marshal(&comet)
 		if err != nil {
 			return err
 		}
@@ -332,28 +2816,235 @@ func (s *BadgerStore) dbSetEvents(comets []types.Comet) error {
 		if err != nil && isDBKeyNotFound(err) {
 			new = true
 		}
+		if new {
+			written++
+		} else {
+			skipped++
+		}
 		//insert [event hash] => [event bytes]
 		if err := tx.Set([]byte(cometHex), val); err != nil {
 			return err
 		}
 
 		if new {
-			//insert [topo_index] => [event hash]
-			topoKey := topologicalEventKey(comet.TopologicalIndex)
-			if err := tx.Set(topoKey, []byte(cometHex)); err != nil {
+			if !s.conf.DisableTopoIndex {
+				if s.conf.LazyTopoIndex {
+					//defer the [topo_index] => [event hash] write
+					lazyTopo[comet.TopologicalIndex] = cometHex
+				} else {
+					//insert [topo_index] => [event hash]
+					topoKey := topologicalEventKey(comet.TopologicalIndex)
+					if err := tx.Set(topoKey, []byte(cometHex)); err != nil {
+						return err
+					}
+				}
+				//insert [event hash] => [topo_index] reverse mapping
+				htKey := hashTopoKey(cometHex)
+				htVal := []byte(strconv.Itoa(comet.TopologicalIndex))
+				if err := tx.Set(htKey, htVal); err != nil {
+					return err
+				}
+				if comet.TopologicalIndex > maxNewTopo {
+					maxNewTopo = comet.TopologicalIndex
+				}
+				newCount++
+			}
+			if !s.conf.DisableParticipantIndex {
+				//insert [participant_index] => [event hash]
+				peKey := participantEventKey(comet.Creator(), comet.Index())
+				if err := tx.Set(peKey, []byte(cometHex)); err != nil {
+					return err
+				}
+			}
+			//insert [parent hash] => [child hash] reverse links so the DAG
+			//can be walked forward
+			for _, parent := range comet.Body.Parents {
+				if parent == "" {
+					continue
+				}
+				if err := tx.Set(childKey(parent, cometHex), []byte(cometHex)); err != nil {
+					return err
+				}
+			}
+			//insert [time_nanos_hash] => [event hash] for time-range scans
+			tKey := timeKey(comet.Body.Timestamp.UnixNano(), cometHex)
+			if err := tx.Set(tKey, []byte(cometHex)); err != nil {
 				return err
 			}
-			//insert [participant_index] => [event hash]
-			peKey := participantEventKey(comet.Creator(), comet.Index())
-			if err := tx.Set(peKey, []byte(cometHex)); err != nil {
+		}
+		//round-received is usually assigned on a later re-store of an
+		//existing event, so this index is maintained outside the new guard
+		if comet.RoundReceived != nil {
+			rrKey := roundReceivedKey(*comet.RoundReceived, cometHex)
+			if err := tx.Set(rrKey, []byte(cometHex)); err != nil {
 				return err
 			}
 		}
 	}
-	return tx.Commit(nil)
+	if err := tx.Commit(nil); err != nil {
+		return err
+	}
+	s.metrics.dedup(written, skipped)
+	if len(lazyTopo) > 0 {
+		s.pendingTopoLock.Lock()
+		if s.pendingTopo == nil {
+			s.pendingTopo = make(map[int]string)
+		}
+		for index, hash := range lazyTopo {
+			s.pendingTopo[index] = hash
+		}
+		full := len(s.pendingTopo) >= lazyTopoFlushThreshold
+		s.pendingTopoLock.Unlock()
+		if full {
+			if err := s.flushTopoIndex(); err != nil {
+				return err
+			}
+		}
+	}
+	//keep the cached events count current once EventsCount has seeded it
+	if newCount > 0 {
+		for {
+			c := atomic.LoadInt64(&s.eventsCount)
+			if c < 0 || atomic.CompareAndSwapInt64(&s.eventsCount, c, c+int64(newCount)) {
+				break
+			}
+		}
+		//keep the cached max topo index current once seeded
+		for {
+			m := atomic.LoadInt64(&s.maxTopoIndex)
+			if m == -2 || int64(maxNewTopo) <= m ||
+				atomic.CompareAndSwapInt64(&s.maxTopoIndex, m, int64(maxNewTopo)) {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+//lazyTopoFlushThreshold bounds how many buffered topo entries accumulate
+//before LazyTopoIndex forces a flush
+const lazyTopoFlushThreshold = 1000
+
+//flushTopoIndex writes the buffered topo index entries in one transaction.
+//On failure the entries are put back so nothing is lost.
+func (s *BadgerStore) flushTopoIndex() error {
+	s.pendingTopoLock.Lock()
+	pending := s.pendingTopo
+	s.pendingTopo = make(map[int]string)
+	s.pendingTopoLock.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	tx := s.db.NewTransaction(true)
+	defer tx.Discard()
+	for index, hash := range pending {
+		if err := tx.Set(topologicalEventKey(index), []byte(hash)); err != nil {
+			s.restorePendingTopo(pending)
+			return err
+		}
+	}
+	if err := tx.Commit(nil); err != nil {
+		s.restorePendingTopo(pending)
+		return err
+	}
+	return nil
+}
+
+func (s *BadgerStore) restorePendingTopo(pending map[int]string) {
+	s.pendingTopoLock.Lock()
+	defer s.pendingTopoLock.Unlock()
+	if s.pendingTopo == nil {
+		s.pendingTopo = make(map[int]string)
+	}
+	for index, hash := range pending {
+		//keep whatever was buffered since the failed flush
+		if _, ok := s.pendingTopo[index]; !ok {
+			s.pendingTopo[index] = hash
+		}
+	}
+}
+
+//appendPendingTopo merges the unflushed topo tail into a disk-ordered event
+//list. Buffered entries are strictly newer than anything flushed, so sorting
+//them by index and appending preserves the topological order.
+func (s *BadgerStore) appendPendingTopo(res []types.Comet) ([]types.Comet, error) {
+	s.pendingTopoLock.Lock()
+	indexes := make([]int, 0, len(s.pendingTopo))
+	hashes := make(map[int]string, len(s.pendingTopo))
+	for index, hash := range s.pendingTopo {
+		indexes = append(indexes, index)
+		hashes[index] = hash
+	}
+	s.pendingTopoLock.Unlock()
+
+	sort.Ints(indexes)
+	for _, index := range indexes {
+		comet, err := s.GetComet(hashes[index])
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, comet)
+	}
+	return res, nil
+}
+
+//EventsCount returns the total number of stored events using a key-only scan
+//of the topological index, no value decoding involved. The result is cached
+//and kept current by dbSetEvents, so repeated calls are O(1).
+func (s *BadgerStore) EventsCount() (int, error) {
+	if s.conf.DisableTopoIndex {
+		return 0, errors.NewStoreErr(errors.IndexDisabled, topoPrefix)
+	}
+	if c := atomic.LoadInt64(&s.eventsCount); c >= 0 {
+		return int(c), nil
+	}
+	count := 0
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		prefix := []byte(topoPrefix + "_")
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			count++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	//the unflushed lazy tail is part of the count too
+	s.pendingTopoLock.Lock()
+	count += len(s.pendingTopo)
+	s.pendingTopoLock.Unlock()
+	atomic.StoreInt64(&s.eventsCount, int64(count))
+	return count, nil
+}
+
+//EventTopoIndex is the reverse of the topological index: given an event hash
+//it returns the event's topological index, so iteration can resume from a
+//known hash. Unknown hashes yield an errors.KeyNotFound error.
+func (s *BadgerStore) EventTopoIndex(hash string) (int, error) {
+	if s.conf.DisableTopoIndex {
+		return -1, errors.NewStoreErr(errors.IndexDisabled, topoPrefix)
+	}
+	key := hashTopoKey(hash)
+	val, err := s.kvGet(key)
+	if err != nil {
+		return -1, mapError(err, string(key))
+	}
+	index, err := strconv.Atoi(string(val))
+	if err != nil {
+		return -1, errors.NewStoreErr(errors.DecodeError, string(key))
+	}
+	return index, nil
 }
 
 func (s *BadgerStore) DbTopologicalEvents() ([]types.Comet, error) {
+	if s.conf.DisableTopoIndex {
+		return nil, errors.NewStoreErr(errors.IndexDisabled, topoPrefix)
+	}
 	var res []types.Comet
 	t := 0
 	err := s.db.View(func(txn *badger.Txn) error {
@@ -368,35 +3059,236 @@ func (s *BadgerStore) DbTopologicalEvents() ([]types.Comet, error) {
 			evKey := string(v)
 			eventItem, err := txn.Get([]byte(evKey))
 			if err != nil {
-				return err
+				return err
+			}
+			eventBytes, err := eventItem.Value()
+			if err != nil {
+				return err
+			}
+
+			comet := new(types.Comet)
+			if err := comet.Unmarshal(eventBytes); err != nil {
+				return err
+			}
+			res = append(res, *comet)
+
+			t++
+			key = topologicalEventKey(t)
+			item, errr = txn.Get(key)
+		}
+
+		if !isDBKeyNotFound(errr) {
+			return errr
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if s.conf.LazyTopoIndex {
+		return s.appendPendingTopo(res)
+	}
+	return res, nil
+}
+
+//DbTopologicalEventsPrefetch returns the same ordered result as
+//DbTopologicalEvents but replaces the two point Gets per event with two
+//prefetching iterators: one over the topo index, one over the event keys.
+func (s *BadgerStore) DbTopologicalEventsPrefetch() ([]types.Comet, error) {
+	if s.conf.DisableTopoIndex {
+		return nil, errors.NewStoreErr(errors.IndexDisabled, topoPrefix)
+	}
+	var res []types.Comet
+	err := s.db.View(func(txn *badger.Txn) error {
+		//first pass: collect event hashes in topological order
+		hashes := []string{}
+		wanted := make(map[string]int)
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		prefix := []byte(topoPrefix + "_")
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			v, err := it.Item().Value()
+			if err != nil {
+				it.Close()
+				return err
+			}
+			h := string(v)
+			wanted[h] = len(hashes)
+			hashes = append(hashes, h)
+		}
+		it.Close()
+
+		//second pass: resolve event bytes; all event keys share the 0x prefix
+		res = make([]types.Comet, len(hashes))
+		found := 0
+		it = txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		evPrefix := []byte("0x")
+		for it.Seek(evPrefix); it.ValidForPrefix(evPrefix); it.Next() {
+			item := it.Item()
+			pos, ok := wanted[string(item.Key())]
+			if !ok {
+				continue
+			}
+			v, err := item.Value()
+			if err != nil {
+				return err
+			}
+			comet := new(types.Comet)
+			if err := comet.Unmarshal(v); err != nil {
+				return err
+			}
+			res[pos] = *comet
+			found++
+		}
+
+		if found != len(hashes) {
+			return badger.ErrKeyNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if s.conf.LazyTopoIndex {
+		return s.appendPendingTopo(res)
+	}
+	return res, nil
+}
+
+//maxTopoIndexSeeded returns the highest topological index in the store,
+//seeding the cached value with a reverse key-only seek on first use;
+//dbSetEvents keeps it current afterwards. -1 means the store has no events.
+func (s *BadgerStore) maxTopoIndexSeeded() (int, error) {
+	if m := atomic.LoadInt64(&s.maxTopoIndex); m != -2 {
+		return int(m), nil
+	}
+	max := -1
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Reverse = true
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		prefix := []byte(topoPrefix + "_")
+		//seek past the last topo key and walk backwards
+		seek := append(append([]byte{}, prefix...), 0xFF)
+		it.Seek(seek)
+		if !it.ValidForPrefix(prefix) {
+			return nil
+		}
+		key := string(it.Item().Key())
+		index, err := strconv.Atoi(key[len(prefix):])
+		if err != nil {
+			return errors.NewStoreErr(errors.DecodeError, key)
+		}
+		max = index
+		return nil
+	})
+	if err != nil {
+		return -1, err
+	}
+	//the unflushed lazy tail holds the newest indexes
+	s.pendingTopoLock.Lock()
+	for index := range s.pendingTopo {
+		if index > max {
+			max = index
+		}
+	}
+	s.pendingTopoLock.Unlock()
+	atomic.StoreInt64(&s.maxTopoIndex, int64(max))
+	return max, nil
+}
+
+//RecentEvents returns up to limit events newest-first, reading the
+//topological index in reverse from the cached max index. It is the
+//recent-first counterpart of DbTopologicalEvents for live feeds; an empty
+//store yields an empty slice.
+func (s *BadgerStore) RecentEvents(limit int) ([]types.Comet, error) {
+	if s.conf.DisableTopoIndex {
+		return nil, errors.NewStoreErr(errors.IndexDisabled, topoPrefix)
+	}
+	res := []types.Comet{}
+	if limit <= 0 {
+		return res, nil
+	}
+	max, err := s.maxTopoIndexSeeded()
+	if err != nil {
+		return nil, err
+	}
+	for t := max; t >= 0 && len(res) < limit; t-- {
+		hash := ""
+		if s.conf.LazyTopoIndex {
+			s.pendingTopoLock.Lock()
+			hash = s.pendingTopo[t]
+			s.pendingTopoLock.Unlock()
+		}
+		if hash == "" {
+			err := s.db.View(func(txn *badger.Txn) error {
+				item, err := txn.Get(topologicalEventKey(t))
+				if err != nil {
+					return err
+				}
+				v, err := item.Value()
+				if err != nil {
+					return err
+				}
+				hash = string(v)
+				return nil
+			})
+			if err != nil {
+				return nil, mapError(err, string(topologicalEventKey(t)))
+			}
+		}
+		comet, err := s.GetComet(hash)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, comet)
+	}
+	return res, nil
+}
+
+//EventsByTimeRange returns the hashes of events whose creator-claimed
+//timestamp falls in [fromNanos, toNanos], oldest first, by range-scanning
+//the time index dbSetEvents maintains. Events sharing a timestamp are
+//ordered by hash, courtesy of the key's hash suffix.
+func (s *BadgerStore) EventsByTimeRange(fromNanos, toNanos int64) ([]string, error) {
+	res := []string{}
+	if toNanos < fromNanos {
+		return res, nil
+	}
+	err := s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		prefix := []byte(timePrefix + "_")
+		seek := []byte(fmt.Sprintf("%s_%020d_", timePrefix, fromNanos))
+		for it.Seek(seek); it.ValidForPrefix(prefix); it.Next() {
+			key := string(it.Item().Key())
+			nanos, err := strconv.ParseInt(key[len(prefix):len(prefix)+20], 10, 64)
+			if err != nil {
+				continue
 			}
-			eventBytes, err := eventItem.Value()
-			if err != nil {
-				return err
+			if nanos > toNanos {
+				break
 			}
-
-			comet := new(types.Comet)
-			if err := comet.Unmarshal(eventBytes); err != nil {
+			v, err := it.Item().Value()
+			if err != nil {
 				return err
 			}
-			res = append(res, *comet)
-
-			t++
-			key = topologicalEventKey(t)
-			item, errr = txn.Get(key)
-		}
-
-		if !isDBKeyNotFound(errr) {
-			return errr
+			res = append(res, string(v))
 		}
-
 		return nil
 	})
-
 	return res, err
 }
 
 func (s *BadgerStore) dbParticipantEvents(participant string, skip int) ([]string, error) {
+	if s.conf.DisableParticipantIndex {
+		return []string{}, errors.NewStoreErr(errors.IndexDisabled, participant)
+	}
 	res := []string{}
 	err := s.db.View(func(txn *badger.Txn) error {
 		i := skip + 1
@@ -423,7 +3315,262 @@ func (s *BadgerStore) dbParticipantEvents(participant string, skip int) ([]strin
 	return res, err
 }
 
+//ForEachParticipantEvent streams a participant's event hashes with index >
+//skip, in index order, without buffering them in a slice. The walk happens
+//inside one View and stops at the first gap, on fn error (propagated, except
+//ErrStopIteration) or when the index runs out. This is the allocation-free
+//counterpart of ParticipantEvents for very long participant histories.
+func (s *BadgerStore) ForEachParticipantEvent(participant string, skip int, fn func(hash string) error) error {
+	if s.conf.DisableParticipantIndex {
+		return errors.NewStoreErr(errors.IndexDisabled, participant)
+	}
+	err := s.db.View(func(txn *badger.Txn) error {
+		for i := skip + 1; ; i++ {
+			item, err := txn.Get(participantEventKey(participant, i))
+			if err != nil {
+				if isDBKeyNotFound(err) {
+					return nil
+				}
+				return err
+			}
+			v, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			if err := fn(string(v)); err != nil {
+				return err
+			}
+		}
+	})
+	if err == ErrStopIteration {
+		return nil
+	}
+	return err
+}
+
+//ParticipantEventCounts returns a pubkey->count map of the number of indexed
+//events per participant, for all participants at once. The counts come from
+//key-only scans over each participant's event index inside one View, so no
+//event bodies are read.
+func (s *BadgerStore) ParticipantEventCounts() (map[string]int, error) {
+	if s.conf.DisableParticipantIndex {
+		return nil, errors.NewStoreErr(errors.IndexDisabled, "participant index")
+	}
+	participants, err := s.Participants()
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int)
+	err = s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for p := range participants {
+			prefix := []byte(fmt.Sprintf("%s__event_", p))
+			count := 0
+			for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+				count++
+			}
+			counts[p] = count
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+//Children returns the hashes of the events that name hash as one of their
+//parents, enabling forward DAG walks for visualization. The reverse links
+//are maintained by dbSetEvents; an event with no known children yields an
+//empty slice.
+func (s *BadgerStore) Children(hash string) ([]string, error) {
+	res := []string{}
+	prefix := []byte(fmt.Sprintf("%s_%s_", childrenPrefix, hash))
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			v, err := it.Item().Value()
+			if err != nil {
+				return err
+			}
+			res = append(res, string(v))
+		}
+		return nil
+	})
+	return res, err
+}
+
+//EventParents resolves a comet's self-parent and other-parent into full
+//comets in one call, cache-first through GetComet. The returned errors are
+//typed and carry the offending side in their key, so a missing self-parent
+//("selfparent <hash>") is distinguishable from a missing other-parent
+//("otherparent <hash>"). Root-anchored events have no self-parent and yield
+//a KeyNotFound error for it.
+func (s *BadgerStore) EventParents(hash string) (selfParent, otherParent types.Comet, err error) {
+	comet, err := s.GetComet(hash)
+	if err != nil {
+		return selfParent, otherParent, err
+	}
+	sp := comet.SelfParent()
+	if sp == "" {
+		return selfParent, otherParent, errors.NewStoreErr(errors.KeyNotFound, "selfparent "+hash)
+	}
+	selfParent, err = s.GetComet(sp)
+	if err != nil {
+		return selfParent, otherParent, errors.NewStoreErr(errors.KeyNotFound, "selfparent "+sp)
+	}
+	op := comet.OtherParent()
+	if op == "" {
+		return selfParent, otherParent, errors.NewStoreErr(errors.KeyNotFound, "otherparent "+hash)
+	}
+	otherParent, err = s.GetComet(op)
+	if err != nil {
+		return selfParent, otherParent, errors.NewStoreErr(errors.KeyNotFound, "otherparent "+op)
+	}
+	return selfParent, otherParent, nil
+}
+
+//OrphanEvents returns the hashes of stored events with at least one
+//non-empty parent that is not itself a stored event, so sync can issue
+//targeted re-requests for the missing parents. The whole check runs
+//read-only inside one View, streaming over the event keyspace without
+//buffering event bodies. Root-anchored events (empty parent hashes) are
+//not orphans.
+func (s *BadgerStore) OrphanEvents() ([]string, error) {
+	orphans := []string{}
+	err := s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		prefix := []byte("0x")
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			item := it.Item()
+			key := string(item.Key())
+			if strings.Contains(key, "__event_") || strings.HasSuffix(key, "_"+rootSuffix) {
+				continue
+			}
+			v, err := item.Value()
+			if err != nil {
+				return err
+			}
+			comet := new(types.Comet)
+			if err := s.codec.Unmarshal(v, comet); err != nil {
+				return errors.NewStoreErr(errors.DecodeError, key)
+			}
+			for _, parent := range comet.Body.Parents {
+				if parent == "" {
+					continue
+				}
+				if _, err := txn.Get([]byte(parent)); err != nil {
+					if !isDBKeyNotFound(err) {
+						return err
+					}
+					orphans = append(orphans, key)
+					break
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(orphans)
+	return orphans, nil
+}
+
+//EventDepth returns an event's depth: the length of the longest parent path
+//to a root anchor. Root-anchored events (all parents empty or resolving to
+//roots rather than stored events) have depth 0. Depths are computed on
+//demand by walking the parent links and memoized for the life of the store,
+//so repeated queries over the same DAG region are cheap.
+func (s *BadgerStore) EventDepth(hash string) (int, error) {
+	s.depthCacheLock.Lock()
+	defer s.depthCacheLock.Unlock()
+	return s.eventDepth(hash)
+}
+
+func (s *BadgerStore) eventDepth(hash string) (int, error) {
+	if d, ok := s.depthCache[hash]; ok {
+		return d, nil
+	}
+	comet, err := s.GetComet(hash)
+	if err != nil {
+		return -1, err
+	}
+	depth := 0
+	for _, parent := range comet.Body.Parents {
+		if parent == "" {
+			continue
+		}
+		pd, err := s.eventDepth(parent)
+		if err != nil {
+			if errors.Is(err, errors.KeyNotFound) {
+				//parent is a root anchor, not a stored event
+				continue
+			}
+			return -1, err
+		}
+		if pd+1 > depth {
+			depth = pd + 1
+		}
+	}
+	if s.depthCache == nil {
+		s.depthCache = make(map[string]int)
+	}
+	s.depthCache[hash] = depth
+	return depth, nil
+}
+
+//GetParticipantEventFull resolves a participant index to both the event hash
+//and the decoded comet in a single View, saving the second round trip of a
+//ParticipantEvent + GetComet pair on sync paths. A missing index or event
+//yields an errors.KeyNotFound error for the participant/index key.
+func (s *BadgerStore) GetParticipantEventFull(participant string, index int) (types.Comet, string, error) {
+	if s.conf.DisableParticipantIndex {
+		return types.Comet{}, "", errors.NewStoreErr(errors.IndexDisabled, participant)
+	}
+	key := participantEventKey(participant, index)
+	hash := ""
+	comet := new(types.Comet)
+	err := s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(key)
+		if err != nil {
+			return err
+		}
+		h, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		hash = string(h)
+		eventItem, err := txn.Get(h)
+		if err != nil {
+			return err
+		}
+		eventBytes, err := eventItem.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		if err := s.codec.Unmarshal(eventBytes, comet); err != nil {
+			//present but undecodable: corruption, not absence
+			return errors.NewStoreErr(errors.DecodeError, hash)
+		}
+		return nil
+	})
+	if err != nil {
+		return types.Comet{}, "", mapError(err, string(key))
+	}
+	return *comet, hash, nil
+}
+
 func (s *BadgerStore) dbParticipantEvent(participant string, index int) (string, error) {
+	if s.conf.DisableParticipantIndex {
+		return "", errors.NewStoreErr(errors.IndexDisabled, participant)
+	}
 	data := []byte{}
 	key := participantEventKey(participant, index)
 	err := s.db.View(func(txn *badger.Txn) error {
@@ -450,6 +3597,15 @@ func (s *BadgerStore) dbSetRoots(roots map[string]types.Root) error {
 		}
 		key := participantRootKey(participant)
 		s.logger.Info().Str("participant", participant).Str("key", string(key)).Msg("dbSetRoots")
+		//append to the root history when overwriting an existing root
+		if s.conf.EnableRootHistory {
+			if _, err := tx.Get(key); err == nil {
+				seq := rootHistoryCount(tx, participant)
+				if err := tx.Set(rootHistoryKey(participant, seq), val); err != nil {
+					return err
+				}
+			}
+		}
 		//insert [participant_root] => [root bytes]
 		if err := tx.Set(key, val); err != nil {
 			return err
@@ -458,6 +3614,68 @@ func (s *BadgerStore) dbSetRoots(roots map[string]types.Root) error {
 	return tx.Commit(nil)
 }
 
+//dbSetGenesisRoots records each participant's original root under its own
+//genesisroot key, writing only where no genesis root exists yet. Unlike the
+//working roots, these are never overwritten by dbSetRoots, so the state a
+//node started from stays verifiable after any number of resets.
+func (s *BadgerStore) dbSetGenesisRoots(roots map[string]types.Root) error {
+	tx := s.db.NewTransaction(true)
+	defer tx.Discard()
+	for participant, root := range roots {
+		key := genesisRootKey(participant)
+		if _, err := tx.Get(key); err == nil {
+			continue
+		} else if !isDBKeyNotFound(err) {
+			return err
+		}
+		val, err := root.Marshal()
+		if err != nil {
+			return err
+		}
+		if err := tx.Set(key, val); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(nil)
+}
+
+func rootHistoryCount(txn *badger.Txn, participant string) int {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	it := txn.NewIterator(opts)
+	defer it.Close()
+	prefix := []byte(fmt.Sprintf("%s_%s_", rootHistPrefix, participant))
+	count := 0
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		count++
+	}
+	return count
+}
+
+//RootHistory returns the append-only history of a participant's root, oldest
+//first. It is only populated when StoreConfig.EnableRootHistory is set.
+func (s *BadgerStore) RootHistory(participant string) ([]types.Root, error) {
+	res := []types.Root{}
+	err := s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		prefix := []byte(fmt.Sprintf("%s_%s_", rootHistPrefix, participant))
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			v, err := it.Item().Value()
+			if err != nil {
+				return err
+			}
+			root := new(types.Root)
+			if err := root.Unmarshal(v); err != nil {
+				return err
+			}
+			res = append(res, *root)
+		}
+		return nil
+	})
+	return res, err
+}
+
 func (s *BadgerStore) dbGetRoot(participant string) (types.Root, error) {
 	var rootBytes []byte
 	key := participantRootKey(participant)
@@ -466,7 +3684,7 @@ func (s *BadgerStore) dbGetRoot(participant string) (types.Root, error) {
 		if err != nil {
 			return err
 		}
-		rootBytes, err = item.Value()
+		rootBytes, err = item.ValueCopy(nil)
 		return err
 	})
 
@@ -482,6 +3700,40 @@ func (s *BadgerStore) dbGetRoot(participant string) (types.Root, error) {
 	return *root, nil
 }
 
+//dbGetAllRoots reads the roots of all given participants within a single
+//View, instead of one transaction per participant as dbGetRoot would cost.
+//The constructors use it at load time, where per-participant transactions
+//add up on large validator sets.
+func (s *BadgerStore) dbGetAllRoots(participants map[string]int) (map[string]types.Root, error) {
+	roots := make(map[string]types.Root)
+	err := s.db.View(func(txn *badger.Txn) error {
+		for p := range participants {
+			item, err := txn.Get(participantRootKey(p))
+			if err != nil {
+				return mapError(err, string(participantRootKey(p)))
+			}
+			rootBytes, err := item.Value()
+			if err != nil {
+				return err
+			}
+			root := new(types.Root)
+			if err := root.Unmarshal(rootBytes); err != nil {
+				return errors.NewStoreErr(errors.DecodeError, string(participantRootKey(p)))
+			}
+			roots[p] = *root
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return roots, nil
+}
+
+//dbGetRound returns the zero RoundInfo together with the real error on
+//failure, never a defaulted NewRoundInfo: a defaulted value made a missing
+//round indistinguishable from an empty one at the db layer. Callers that
+//want an empty round on KeyNotFound default it themselves.
 func (s *BadgerStore) dbGetRound(index int) (types.RoundInfo, error) {
 	var roundBytes []byte
 	key := roundKey(index)
@@ -490,17 +3742,17 @@ func (s *BadgerStore) dbGetRound(index int) (types.RoundInfo, error) {
 		if err != nil {
 			return err
 		}
-		roundBytes, err = item.Value()
+		roundBytes, err = item.ValueCopy(nil)
 		return err
 	})
 
 	if err != nil {
-		return *types.NewRoundInfo(), err
+		return types.RoundInfo{}, err
 	}
 
 	roundInfo := new(types.RoundInfo)
 	if err := roundInfo.Unmarshal(roundBytes); err != nil {
-		return *types.NewRoundInfo(), err
+		return types.RoundInfo{}, errors.NewStoreErr(errors.DecodeError, string(key))
 	}
 
 	return *roundInfo, nil
@@ -524,27 +3776,35 @@ func (s *BadgerStore) dbSetRound(index int, round types.RoundInfo) error {
 	return tx.Commit(nil)
 }
 
-func (s *BadgerStore) dbGetParticipants() (map[string]int, error) {
-	res := make(map[string]int)
+//key-only scan of the persisted consensus index
+func (s *BadgerStore) dbConsensusEventsCount() (int, error) {
+	count := 0
 	err := s.db.View(func(txn *badger.Txn) error {
-		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
 		defer it.Close()
-		prefix := []byte(participantPrefix)
+		prefix := []byte(consensusPrefix + "_")
 		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
-			item := it.Item()
-			k := string(item.Key())
-			v, err := item.Value()
-			if err != nil {
-				return err
-			}
-			//key is of the form participant_0x.......
-			pubKey := k[len(participantPrefix)+1:]
-			id, err := strconv.Atoi(string(v))
-			if err != nil {
-				return err
-			}
-			res[pubKey] = id
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+func (s *BadgerStore) dbGetParticipants() (map[string]int, error) {
+	res := make(map[string]int)
+	//the trailing _ keeps sibling namespaces (participantweight_) out
+	prefix := []byte(participantPrefix + "_")
+	err := s.kv.Iterate(prefix, false, func(key, value []byte) error {
+		//key is of the form participant_0x.......
+		pubKey := string(key)[len(prefix):]
+		id, err := strconv.Atoi(string(value))
+		if err != nil {
+			return err
 		}
+		res[pubKey] = id
 		return nil
 	})
 	return res, err
@@ -572,7 +3832,7 @@ func (s *BadgerStore) dbGetBlock(index int) (types.Block, error) {
 		if err != nil {
 			return err
 		}
-		blockBytes, err = item.Value()
+		blockBytes, err = item.ValueCopy(nil)
 		return err
 	})
 
@@ -603,26 +3863,65 @@ func (s *BadgerStore) dbSetBlock(block types.Block) error {
 		return err
 	}
 
+	//insert [round received] => [block index] reverse mapping
+	rbKey := roundBlockKey(block.RoundReceived())
+	rbVal := []byte(strconv.Itoa(block.Index()))
+	if err := tx.Set(rbKey, rbVal); err != nil {
+		return err
+	}
+
+	//insert [index] => [body hash] so GetBlockChecked can detect corruption
+	bodyHash, err := block.Body.Hash()
+	if err != nil {
+		return err
+	}
+	if err := tx.Set(blockHashKey(block.Index()), bodyHash); err != nil {
+		return err
+	}
+
 	return tx.Commit(nil)
 }
 
-func (s *BadgerStore) Get(key []byte) (value []byte, err error) {
-	err = s.db.View(func(txn *badger.Txn) error {
-		item, err := txn.Get(key)
-		if err != nil {
-			return err
+func (s *BadgerStore) dbLastNBlocks(n int) ([]types.Block, error) {
+	res := []types.Block{}
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Reverse = true
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		prefix := []byte(blockPrefix + "_")
+		//seek past the last block key and walk backwards
+		seek := append(prefix, 0xFF)
+		for it.Seek(seek); it.ValidForPrefix(prefix) && len(res) < n; it.Next() {
+			item := it.Item()
+			v, err := item.Value()
+			if err != nil {
+				return err
+			}
+			block := new(types.Block)
+			if err := block.Unmarshal(v); err != nil {
+				return err
+			}
+			res = append(res, *block)
 		}
-		value, err = item.Value()
-		return err
+		return nil
 	})
+	return res, err
+}
 
-	if err != nil {
-		return nil, err
-	}
-	return
+//Get/Has/Put expose the raw KV namespace to the application. With
+//StoreConfig.MetadataPath set they are backed by a dedicated db so app-state
+//churn never interferes with compaction of the consensus data; the internal
+//kvGet/kvPut variants stay pinned to the consensus db either way.
+func (s *BadgerStore) Get(key []byte) (value []byte, err error) {
+	return s.appKV.Get(key)
 }
 func (s *BadgerStore) Has(key []byte) (has bool, err error) {
-	err = s.db.View(func(txn *badger.Txn) error {
+	db := s.db
+	if s.metaDB != nil {
+		db = s.metaDB
+	}
+	err = db.View(func(txn *badger.Txn) error {
 		item, err := txn.Get(key)
 		if err != nil {
 			return err
@@ -637,13 +3936,19 @@ func (s *BadgerStore) Has(key []byte) (has bool, err error) {
 	return
 }
 func (s *BadgerStore) Put(key, value []byte) error {
-	tx := s.db.NewTransaction(true)
-	defer tx.Discard()
+	s.acquireWrite()
+	defer s.releaseWrite()
+	return s.appKV.Set(key, value)
+}
 
-	if err := tx.Set(key, value); err != nil {
-		return err
-	}
-	return tx.Commit(nil)
+func (s *BadgerStore) kvGet(key []byte) ([]byte, error) {
+	return s.kv.Get(key)
+}
+
+func (s *BadgerStore) kvPut(key, value []byte) error {
+	s.acquireWrite()
+	defer s.releaseWrite()
+	return s.kv.Set(key, value)
 }
 
 //++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++
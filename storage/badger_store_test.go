@@ -0,0 +1,3053 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/paradigm-network/paradigm/common/crypto"
+	"github.com/paradigm-network/paradigm/common/log"
+	"github.com/paradigm-network/paradigm/errors"
+	"github.com/paradigm-network/paradigm/types"
+)
+
+func TestMain(m *testing.M) {
+	log.InitRotateWriter(filepath.Join(os.TempDir(), "storage_test.log"))
+	os.Exit(m.Run())
+}
+
+func initBadgerStore(t testing.TB, cacheSize int) (*BadgerStore, string) {
+	dir, err := ioutil.TempDir("", "badger")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	participants := map[string]int{
+		"0xAA": 0,
+		"0xBB": 1,
+		"0xCC": 2,
+	}
+
+	store, err := NewBadgerStore(participants, cacheSize, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return store, dir
+}
+
+func removeBadgerStore(store *BadgerStore, dir string) {
+	store.Close()
+	os.RemoveAll(dir)
+}
+
+func newTestComet(creator byte, index, topoIndex int) types.Comet {
+	comet := types.NewComet([][]byte{[]byte("tx")}, nil, []string{"", ""}, []byte{creator}, index)
+	comet.TopologicalIndex = topoIndex
+	return comet
+}
+
+func populateEvents(t testing.TB, store *BadgerStore, n int) []types.Comet {
+	comets := make([]types.Comet, n)
+	for i := 0; i < n; i++ {
+		comets[i] = newTestComet(0xAA, i, i)
+	}
+	//write in chunks to stay below the badger transaction size limit
+	for start := 0; start < n; start += 1000 {
+		end := start + 1000
+		if end > n {
+			end = n
+		}
+		if err := store.dbSetEvents(comets[start:end]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return comets
+}
+
+func TestDbTopologicalEventsPrefetch(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	populateEvents(t, store, 50)
+
+	expected, err := store.DbTopologicalEvents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.DbTopologicalEventsPrefetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != len(expected) {
+		t.Fatalf("expected %d events, got %d", len(expected), len(got))
+	}
+	for i := range expected {
+		if got[i].Hex() != expected[i].Hex() {
+			t.Fatalf("events differ at position %d", i)
+		}
+	}
+}
+
+func benchmarkTopologicalEvents(b *testing.B, f func(*BadgerStore) ([]types.Comet, error)) {
+	store, dir := initBadgerStore(b, 10)
+	defer removeBadgerStore(store, dir)
+
+	populateEvents(b, store, 50000)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := f(store); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDbTopologicalEvents(b *testing.B) {
+	benchmarkTopologicalEvents(b, (*BadgerStore).DbTopologicalEvents)
+}
+
+func BenchmarkDbTopologicalEventsPrefetch(b *testing.B) {
+	benchmarkTopologicalEvents(b, (*BadgerStore).DbTopologicalEventsPrefetch)
+}
+
+func TestValueCopyUnderConcurrentWrites(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	comets := populateEvents(t, store, 100)
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+
+	//writers keep appending events and blocks to force compaction activity
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		i := 0
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			comet := newTestComet(0xBB, i, 100+i)
+			if err := store.dbSetEvents([]types.Comet{comet}); err != nil {
+				t.Error(err)
+				return
+			}
+			if err := store.dbSetBlock(types.NewBlock(i, i, [][]byte{[]byte("tx")})); err != nil {
+				t.Error(err)
+				return
+			}
+			i++
+		}
+	}()
+
+	//readers re-decode known events and check them for corruption
+	var readers sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for i := 0; i < 500; i++ {
+				comet := comets[i%len(comets)]
+				got, err := store.dbGetEvent(comet.Hex())
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if got.Creator() != comet.Creator() || got.Index() != comet.Index() {
+					t.Errorf("corrupted read: got %s/%d, want %s/%d",
+						got.Creator(), got.Index(), comet.Creator(), comet.Index())
+					return
+				}
+			}
+		}()
+	}
+
+	readers.Wait()
+	close(done)
+	wg.Wait()
+}
+
+func TestConcurrentParticipantAccess(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	var wg sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				store.KnownEvents()
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			p := fmt.Sprintf("0xD%d", i)
+			if err := store.AddParticipant(p, 10+i); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+
+	participants, err := store.Participants()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(participants) != 23 {
+		t.Fatalf("expected 23 participants, got %d", len(participants))
+	}
+}
+
+func TestConsensusEventsCountAcrossRestart(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer os.RemoveAll(dir)
+
+	for i, key := range []string{"e0", "e1", "e2"} {
+		if err := store.AddConsensusEvent(key); err != nil {
+			t.Fatal(err)
+		}
+		if c := store.ConsensusEventsCount(); c != i+1 {
+			t.Fatalf("expected count %d, got %d", i+1, c)
+		}
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	//a restarted store falls back to the persisted count
+	reloaded, err := LoadBadgerStore(10, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Close()
+
+	if c := reloaded.ConsensusEventsCount(); c != 3 {
+		t.Fatalf("expected count 3 after restart, got %d", c)
+	}
+
+	//appends after the restart continue the persisted sequence
+	if err := reloaded.AddConsensusEvent("e3"); err != nil {
+		t.Fatal(err)
+	}
+	v, err := reloaded.Get(consensusEventKey(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(v) != "e3" {
+		t.Fatalf("expected e3 at consensus index 3, got %s", string(v))
+	}
+}
+
+func TestGeneration(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer os.RemoveAll(dir)
+
+	g, err := store.Generation()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g != 0 {
+		t.Fatalf("expected generation 0, got %d", g)
+	}
+
+	if err := store.Reset(make(map[string]types.Root)); err != nil {
+		t.Fatal(err)
+	}
+	if g, _ = store.Generation(); g != 1 {
+		t.Fatalf("expected generation 1 after reset, got %d", g)
+	}
+
+	//the generation survives a reload
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := LoadBadgerStore(10, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Close()
+
+	if g, _ = reloaded.Generation(); g != 1 {
+		t.Fatalf("expected generation 1 after reload, got %d", g)
+	}
+	if err := reloaded.Reset(make(map[string]types.Root)); err != nil {
+		t.Fatal(err)
+	}
+	if g, _ = reloaded.Generation(); g != 2 {
+		t.Fatalf("expected generation 2, got %d", g)
+	}
+}
+
+func TestRoundEventComets(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	//cached event
+	cached := newTestComet(0xAA, 0, 0)
+	if err := store.SetComet(cached); err != nil {
+		t.Fatal(err)
+	}
+
+	//disk-only event, bypassing the inmem cache
+	disk := newTestComet(0xBB, 0, 1)
+	raw, err := disk.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetEventBytes(disk.Hex(), 1, 0, "0xBB", raw); err != nil {
+		t.Fatal(err)
+	}
+
+	round := types.NewRoundInfo()
+	round.AddEvent(cached.Hex(), true)
+	round.AddEvent(disk.Hex(), false)
+	if err := store.SetRound(0, *round); err != nil {
+		t.Fatal(err)
+	}
+
+	comets, err := store.RoundEventComets(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(comets) != 2 {
+		t.Fatalf("expected 2 comets, got %d", len(comets))
+	}
+
+	//a missing event is reported but does not hide the others
+	round.AddEvent("0xMISSING", false)
+	if err := store.SetRound(1, *round); err != nil {
+		t.Fatal(err)
+	}
+	comets, err = store.RoundEventComets(1)
+	if err == nil {
+		t.Fatal("expected an aggregated error for the missing event")
+	}
+	if len(comets) != 2 {
+		t.Fatalf("expected 2 comets alongside the error, got %d", len(comets))
+	}
+}
+
+func TestGetCometErrorClassification(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	//found
+	comet := newTestComet(0xAA, 0, 0)
+	if err := store.SetComet(comet); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GetComet(comet.Hex()); err != nil {
+		t.Fatal(err)
+	}
+
+	//absent
+	if _, err := store.GetComet("0xNOPE"); !errors.Is(err, errors.KeyNotFound) {
+		t.Fatalf("expected KeyNotFound, got %v", err)
+	}
+
+	//present but corrupted
+	if err := store.Put([]byte("0xBAD"), []byte("not json")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GetComet("0xBAD"); !errors.Is(err, errors.DecodeError) {
+		t.Fatalf("expected DecodeError, got %v", err)
+	}
+}
+
+func TestOrderedConsensusEvents(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	base := time.Date(2018, 10, 18, 0, 0, 0, 0, time.UTC)
+
+	mkConsensus := func(creator byte, index, topo, rr int, ts time.Time) types.Comet {
+		comet := newTestComet(creator, index, topo)
+		comet.SetRoundReceived(rr)
+		comet.ConsensusTimestamp = ts
+		return comet
+	}
+
+	later := mkConsensus(0xAA, 0, 0, 2, base)
+	early := mkConsensus(0xBB, 0, 1, 1, base)
+	earlier := mkConsensus(0xCC, 0, 2, 1, base.Add(-time.Second))
+	outside := mkConsensus(0xAA, 1, 3, 5, base)
+	pending := newTestComet(0xBB, 1, 4) //no round received
+
+	if err := store.dbSetEvents([]types.Comet{later, early, earlier, outside, pending}); err != nil {
+		t.Fatal(err)
+	}
+
+	ordered, err := store.OrderedConsensusEvents(1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ordered) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(ordered))
+	}
+	expected := []string{earlier.Hex(), early.Hex(), later.Hex()}
+	for i, h := range expected {
+		if ordered[i].Hex() != h {
+			t.Fatalf("position %d: expected %s, got %s", i, h, ordered[i].Hex())
+		}
+	}
+
+	//the order is deterministic across calls
+	again, err := store.OrderedConsensusEvents(1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range ordered {
+		if again[i].Hex() != ordered[i].Hex() {
+			t.Fatal("order is not deterministic")
+		}
+	}
+}
+
+func TestSetCometValidator(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	store.SetValidator(func(comet types.Comet) error {
+		_, err := store.GetParticipantID(comet.Creator())
+		return err
+	})
+
+	//an event from an unknown creator is rejected before any write
+	rejected := newTestComet(0xEE, 0, 0)
+	if err := store.SetComet(rejected); !errors.Is(err, errors.UnknownParticipant) {
+		t.Fatalf("expected UnknownParticipant, got %v", err)
+	}
+	if _, err := store.GetComet(rejected.Hex()); !errors.Is(err, errors.KeyNotFound) {
+		t.Fatalf("rejected event should not be stored, got %v", err)
+	}
+
+	//an event from a known creator passes
+	accepted := newTestComet(0xAA, 0, 0)
+	if err := store.SetComet(accepted); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GetComet(accepted.Hex()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFirstUndecidedRound(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	//rounds 0-2 decided, round 3 undecided
+	for r := 0; r < 3; r++ {
+		round := types.NewRoundInfo()
+		round.AddEvent(fmt.Sprintf("w%d", r), true)
+		round.SetFame(fmt.Sprintf("w%d", r), true)
+		if err := store.SetRound(r, *round); err != nil {
+			t.Fatal(err)
+		}
+	}
+	undecided := types.NewRoundInfo()
+	undecided.AddEvent("w3", true)
+	if err := store.SetRound(3, *undecided); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := store.FirstUndecidedRound(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != 3 {
+		t.Fatalf("expected first undecided round 3, got %d", first)
+	}
+
+	//the watermark skipped the decided prefix
+	if w := store.undecidedWatermark(); w != 3 {
+		t.Fatalf("expected watermark 3, got %d", w)
+	}
+
+	//from overrides a lower watermark
+	first, err = store.FirstUndecidedRound(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != 3 {
+		t.Fatalf("expected first undecided round 3, got %d", first)
+	}
+
+	//deciding round 3 moves the answer past the last round
+	undecided.SetFame("w3", false)
+	if err := store.SetRound(3, *undecided); err != nil {
+		t.Fatal(err)
+	}
+	first, err = store.FirstUndecidedRound(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != 4 {
+		t.Fatalf("expected first undecided round 4, got %d", first)
+	}
+}
+
+func TestRoundDecided(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	//missing round counts as not-decided with a typed error
+	decided, err := store.RoundDecided(0)
+	if decided {
+		t.Fatal("missing round should not be decided")
+	}
+	if !errors.Is(err, errors.KeyNotFound) {
+		t.Fatalf("missing round should return KeyNotFound, not %v", err)
+	}
+
+	undecided := types.NewRoundInfo()
+	undecided.AddEvent("w0", true)
+	if err := store.SetRound(0, *undecided); err != nil {
+		t.Fatal(err)
+	}
+	decided, err = store.RoundDecided(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decided {
+		t.Fatal("round with an undecided witness should not be decided")
+	}
+
+	undecided.SetFame("w0", true)
+	if err := store.SetRound(0, *undecided); err != nil {
+		t.Fatal(err)
+	}
+	decided, err = store.RoundDecided(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !decided {
+		t.Fatal("round with all witnesses decided should be decided")
+	}
+}
+
+func TestEventBytesRoundTrip(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	comet := newTestComet(0xAA, 0, 0)
+	raw, err := comet.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.SetEventBytes(comet.Hex(), 0, 0, "0xAA", raw); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := store.GetEventBytes(comet.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(raw) {
+		t.Fatal("raw event bytes do not round-trip")
+	}
+
+	//indexes are maintained
+	topoVal, err := store.Get(topologicalEventKey(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(topoVal) != comet.Hex() {
+		t.Fatalf("topo index should map to %s, not %s", comet.Hex(), string(topoVal))
+	}
+	peVal, err := store.Get(participantEventKey("0xAA", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(peVal) != comet.Hex() {
+		t.Fatalf("participant index should map to %s, not %s", comet.Hex(), string(peVal))
+	}
+
+	//typed getter still decodes the stored bytes
+	decoded, err := store.dbGetEvent(comet.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Index() != comet.Index() {
+		t.Fatalf("decoded event should have index %d, not %d", comet.Index(), decoded.Index())
+	}
+
+	//missing hash returns the typed error
+	if _, err := store.GetEventBytes("0xNOPE"); !errors.Is(err, errors.KeyNotFound) {
+		t.Fatalf("expected KeyNotFound, got %v", err)
+	}
+}
+
+func TestBlockHashes(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	for i := 0; i < 3; i++ {
+		block := types.NewBlock(i, i+1, [][]byte{[]byte("tx")})
+		if err := store.SetBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hashes, err := store.BlockHashes(0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hashes) != 3 {
+		t.Fatalf("expected 3 hashes, got %d", len(hashes))
+	}
+	for i, h := range hashes {
+		block, err := store.GetBlock(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h != block.Hex() {
+			t.Fatalf("hashes[%d] should be %s, not %s", i, block.Hex(), h)
+		}
+	}
+
+	//a gap aborts with the typed error of the first missing index
+	if _, err := store.BlockHashes(0, 5); !errors.Is(err, errors.KeyNotFound) {
+		t.Fatalf("expected KeyNotFound at the gap, got %v", err)
+	}
+}
+
+func TestGetManyBlocks(t *testing.T) {
+	store, dir := initBadgerStore(t, 2) //small cache so old blocks fall to disk
+	defer removeBadgerStore(store, dir)
+
+	for i := 0; i < 5; i++ {
+		if err := store.SetBlock(types.NewBlock(i, i+1, [][]byte{[]byte("tx")})); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	//mix of cached (recent) and disk-only (evicted) indices
+	blocks, err := store.GetManyBlocks([]int{4, 0, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 3 {
+		t.Fatalf("expected 3 blocks, got %d", len(blocks))
+	}
+	for i, expected := range []int{4, 0, 2} {
+		if blocks[i].Index() != expected {
+			t.Fatalf("blocks[%d] should have index %d, not %d", i, expected, blocks[i].Index())
+		}
+	}
+
+	//absent indices are aggregated into one error
+	blocks, err = store.GetManyBlocks([]int{1, 7, 9})
+	if err == nil {
+		t.Fatal("expected an error for the missing blocks")
+	}
+	if len(blocks) != 1 || blocks[0].Index() != 1 {
+		t.Fatalf("expected just block 1 alongside the error, got %v", blocks)
+	}
+}
+
+func TestLastNBlocks(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	//empty store returns an empty slice
+	blocks, err := store.LastNBlocks(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 0 {
+		t.Fatalf("expected 0 blocks, got %d", len(blocks))
+	}
+
+	for i := 0; i < 3; i++ {
+		block := types.NewBlock(i, i+1, [][]byte{[]byte("tx")})
+		if err := store.SetBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	//fewer blocks than n: return all of them, newest-first
+	blocks, err = store.LastNBlocks(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 3 {
+		t.Fatalf("expected 3 blocks, got %d", len(blocks))
+	}
+	for i, block := range blocks {
+		if block.Index() != 2-i {
+			t.Fatalf("blocks[%d] should have index %d, not %d", i, 2-i, block.Index())
+		}
+	}
+
+	//more blocks than n: return the n most recent
+	blocks, err = store.LastNBlocks(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 2 {
+		t.Fatalf("expected 2 blocks, got %d", len(blocks))
+	}
+	if blocks[0].Index() != 2 || blocks[1].Index() != 1 {
+		t.Fatalf("expected indexes [2 1], got [%d %d]", blocks[0].Index(), blocks[1].Index())
+	}
+}
+
+func TestForEachBlock(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	for i := 0; i < 5; i++ {
+		block := types.NewBlock(i, i+1, [][]byte{[]byte("tx")})
+		if err := store.SetBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	//blocks are visited in ascending index order
+	visited := []int{}
+	err := store.ForEachBlock(func(block types.Block) error {
+		visited = append(visited, block.Index())
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(visited) != 5 {
+		t.Fatalf("expected 5 blocks, got %d", len(visited))
+	}
+	for i, index := range visited {
+		if index != i {
+			t.Fatalf("visited[%d] should be %d, not %d", i, i, index)
+		}
+	}
+
+	//ErrStopIteration ends the walk early without an error
+	visited = []int{}
+	err = store.ForEachBlock(func(block types.Block) error {
+		visited = append(visited, block.Index())
+		if block.Index() == 2 {
+			return ErrStopIteration
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(visited) != 3 {
+		t.Fatalf("expected 3 blocks, got %d", len(visited))
+	}
+
+	//any other callback error aborts the walk and is propagated
+	fail := fmt.Errorf("boom")
+	err = store.ForEachBlock(func(block types.Block) error {
+		return fail
+	})
+	if err != fail {
+		t.Fatalf("expected %v, got %v", fail, err)
+	}
+}
+
+func TestRootIndex(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	participants, err := store.Participants()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for p := range participants {
+		root, err := store.GetRoot(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		index, err := store.RootIndex(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if index != root.Index {
+			t.Fatalf("RootIndex(%s) should be %d, not %d", p, root.Index, index)
+		}
+	}
+
+	if _, err := store.RootIndex("0xNOPE"); !errors.Is(err, errors.KeyNotFound) {
+		t.Fatalf("expected KeyNotFound, got %v", err)
+	}
+}
+
+func TestParticipantEventsAfterHash(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	comets := []types.Comet{}
+	for i := 0; i < 4; i++ {
+		comet := newTestComet(0xAA, i, i)
+		if err := store.SetComet(comet); err != nil {
+			t.Fatal(err)
+		}
+		comets = append(comets, comet)
+	}
+	other := newTestComet(0xBB, 0, 4)
+	if err := store.SetComet(other); err != nil {
+		t.Fatal(err)
+	}
+
+	//empty hash: everything from index 0
+	hashes, err := store.ParticipantEventsAfterHash("0xAA", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hashes) != 4 {
+		t.Fatalf("expected 4 hashes, got %d", len(hashes))
+	}
+
+	//mid-stream hash: only the events after it
+	hashes, err = store.ParticipantEventsAfterHash("0xAA", comets[1].Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hashes) != 2 {
+		t.Fatalf("expected 2 hashes, got %d", len(hashes))
+	}
+	if hashes[0] != comets[2].Hex() || hashes[1] != comets[3].Hex() {
+		t.Fatalf("wrong hashes returned: %v", hashes)
+	}
+
+	//unknown hash
+	if _, err := store.ParticipantEventsAfterHash("0xAA", "0xNOPE"); !errors.Is(err, errors.KeyNotFound) {
+		t.Fatalf("expected KeyNotFound, got %v", err)
+	}
+
+	//a hash from another participant is not a valid cursor
+	if _, err := store.ParticipantEventsAfterHash("0xAA", other.Hex()); !errors.Is(err, errors.KeyNotFound) {
+		t.Fatalf("expected KeyNotFound, got %v", err)
+	}
+}
+
+func TestEventTopoIndex(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	comets := []types.Comet{}
+	for i := 0; i < 3; i++ {
+		comet := newTestComet(0xAA, i, 10+i)
+		if err := store.SetComet(comet); err != nil {
+			t.Fatal(err)
+		}
+		comets = append(comets, comet)
+	}
+
+	for _, comet := range comets {
+		index, err := store.EventTopoIndex(comet.Hex())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if index != comet.TopologicalIndex {
+			t.Fatalf("expected topo index %d, got %d", comet.TopologicalIndex, index)
+		}
+	}
+
+	if _, err := store.EventTopoIndex("0xNOPE"); !errors.Is(err, errors.KeyNotFound) {
+		t.Fatalf("expected KeyNotFound, got %v", err)
+	}
+}
+
+func TestHead(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	for i := 0; i < 3; i++ {
+		if err := store.SetBlock(types.NewBlock(i, i+1, [][]byte{[]byte("tx")})); err != nil {
+			t.Fatal(err)
+		}
+		round := types.NewRoundInfo()
+		round.AddEvent(fmt.Sprintf("0x%d", i), true)
+		if err := store.SetRound(i, *round); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	head, err := store.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//each field matches its individually-queried value
+	blocks, err := store.LastNBlocks(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head.Block.Index() != blocks[0].Index() {
+		t.Fatalf("expected block %d, got %d", blocks[0].Index(), head.Block.Index())
+	}
+	if head.LastRound != store.LastRound() {
+		t.Fatalf("expected round %d, got %d", store.LastRound(), head.LastRound)
+	}
+	round, err := store.GetRound(head.LastRound)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(head.Round.Events) != len(round.Events) {
+		t.Fatalf("round mismatch: %v vs %v", head.Round, round)
+	}
+	participants, err := store.Participants()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(head.Roots) != len(participants) {
+		t.Fatalf("expected %d roots, got %d", len(participants), len(head.Roots))
+	}
+	for p := range participants {
+		root, err := store.GetRoot(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if head.Roots[p].Index != root.Index {
+			t.Fatalf("root mismatch for %s", p)
+		}
+	}
+}
+
+func TestHeadEmptyStore(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	head, err := store.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head.LastRound != -1 {
+		t.Fatalf("expected LastRound -1, got %d", head.LastRound)
+	}
+	if len(head.Roots) != 3 {
+		t.Fatalf("expected 3 base roots, got %d", len(head.Roots))
+	}
+}
+
+func TestRegisterPrefix(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	prefix, err := store.RegisterPrefix("balances")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//the prefix is usable with the raw accessors
+	key := append(append([]byte{}, prefix...), []byte("0xAA")...)
+	if err := store.Put(key, []byte("100")); err != nil {
+		t.Fatal(err)
+	}
+	val, err := store.Get(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(val) != "100" {
+		t.Fatalf("expected 100, got %s", val)
+	}
+
+	//reserved consensus namespaces are rejected
+	for _, name := range []string{"block", "round", "topo", "participant", "root"} {
+		if _, err := store.RegisterPrefix(name); err == nil {
+			t.Fatalf("reserved name %s should have been rejected", name)
+		}
+	}
+
+	//so are names that nest inside a reserved namespace: "round_000000001"
+	//writes land between real round keys
+	for _, name := range []string{"round_000000001", "block_extra", "blocksig_000000001_x"} {
+		if _, err := store.RegisterPrefix(name); err == nil {
+			t.Fatalf("colliding name %s should have been rejected", name)
+		}
+	}
+
+	//a sibling that merely shares leading characters is a distinct
+	//namespace and stays allowed
+	if _, err := store.RegisterPrefix("rou"); err != nil {
+		t.Fatal(err)
+	}
+
+	//the same containment rule applies between registered app prefixes,
+	//in both directions
+	if _, err := store.RegisterPrefix("balances_hot"); err == nil {
+		t.Fatal("name nested inside a registered prefix should have been rejected")
+	}
+	if _, err := store.RegisterPrefix("acct_meta"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.RegisterPrefix("acct"); err == nil {
+		t.Fatal("name swallowing a registered prefix should have been rejected")
+	}
+
+	//double registration is rejected
+	if _, err := store.RegisterPrefix("balances"); err == nil {
+		t.Fatal("duplicate registration should have been rejected")
+	}
+
+	//the event hash namespace is off limits too
+	if _, err := store.RegisterPrefix("0xdeadbeef"); err == nil {
+		t.Fatal("0x-prefixed name should have been rejected")
+	}
+}
+
+func TestRoundWitnessStates(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	round := types.NewRoundInfo()
+	round.AddEvent("0xW1", true)
+	round.AddEvent("0xW2", true)
+	round.AddEvent("0xW3", true)
+	round.AddEvent("0xE1", false)
+	round.SetFame("0xW1", true)
+	round.SetFame("0xW2", false)
+	if err := store.SetRound(0, *round); err != nil {
+		t.Fatal(err)
+	}
+
+	states, err := store.RoundWitnessStates(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 3 {
+		t.Fatalf("expected 3 witnesses, got %d", len(states))
+	}
+	expected := map[string]WitnessState{
+		"0xW1": {Hash: "0xW1", Decided: true, Famous: true},
+		"0xW2": {Hash: "0xW2", Decided: true, Famous: false},
+		"0xW3": {Hash: "0xW3", Decided: false, Famous: false},
+	}
+	for _, state := range states {
+		if state != expected[state.Hash] {
+			t.Fatalf("unexpected state %+v", state)
+		}
+	}
+
+	//missing round
+	if _, err := store.RoundWitnessStates(99); !errors.Is(err, errors.KeyNotFound) {
+		t.Fatalf("expected KeyNotFound, got %v", err)
+	}
+}
+
+func TestDeleteConsensusEventsFrom(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	for i := 0; i < 5; i++ {
+		if err := store.AddConsensusEvent(fmt.Sprintf("0xevent%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := store.DeleteConsensusEventsFrom(3); err != nil {
+		t.Fatal(err)
+	}
+
+	//cache and disk agree on the shorter list
+	if count := store.ConsensusEventsCount(); count != 3 {
+		t.Fatalf("expected 3 consensus events, got %d", count)
+	}
+	if dbCount, err := store.dbConsensusEventsCount(); err != nil || dbCount != 3 {
+		t.Fatalf("expected 3 persisted entries, got %d (err %v)", dbCount, err)
+	}
+	for i := 3; i < 5; i++ {
+		if _, err := store.Get(consensusEventKey(i)); err == nil {
+			t.Fatalf("entry %d should have been deleted", i)
+		}
+	}
+
+	//re-append a different tail
+	for i := 3; i < 5; i++ {
+		if err := store.AddConsensusEvent(fmt.Sprintf("0xother%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if count := store.ConsensusEventsCount(); count != 5 {
+		t.Fatalf("expected 5 consensus events, got %d", count)
+	}
+	val, err := store.Get(consensusEventKey(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(val) != "0xother3" {
+		t.Fatalf("expected 0xother3 at index 3, got %s", val)
+	}
+	events := store.ConsensusEvents()
+	if events[len(events)-1] != "0xother4" {
+		t.Fatalf("unexpected tail: %v", events)
+	}
+}
+
+func TestVerifyCometSignature(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	key, err := crypto.GenerateECDSAKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := crypto.FromECDSAPub(&key.PublicKey)
+	creator := fmt.Sprintf("0x%X", pub)
+	if err := store.AddParticipant(creator, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	comet := types.NewComet([][]byte{[]byte("tx")}, nil, []string{"", ""}, pub, 0)
+	if err := comet.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+
+	//valid signature
+	ok, err := store.VerifyCometSignature(comet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("expected a valid signature")
+	}
+
+	//tampered body
+	tampered := comet
+	tampered.Body.Transactions = [][]byte{[]byte("evil")}
+	ok, err = store.VerifyCometSignature(tampered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Fatal("tampered body should not verify")
+	}
+
+	//unknown creator
+	strangerKey, err := crypto.GenerateECDSAKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	strangerPub := crypto.FromECDSAPub(&strangerKey.PublicKey)
+	stranger := types.NewComet([][]byte{[]byte("tx")}, nil, []string{"", ""}, strangerPub, 0)
+	if err := stranger.Sign(strangerKey); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.VerifyCometSignature(stranger); !errors.Is(err, errors.UnknownParticipant) {
+		t.Fatalf("expected UnknownParticipant, got %v", err)
+	}
+}
+
+func TestBlockRoundMapping(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	//blocks 0..2 received in rounds 2,4,6
+	for i := 0; i < 3; i++ {
+		if err := store.SetBlock(types.NewBlock(i, 2*(i+1), [][]byte{[]byte("tx")})); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		round, err := store.BlockRound(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if round != 2*(i+1) {
+			t.Fatalf("expected round %d for block %d, got %d", 2*(i+1), i, round)
+		}
+		block, err := store.RoundBlock(round)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if block != i {
+			t.Fatalf("expected block %d for round %d, got %d", i, round, block)
+		}
+	}
+
+	//missing mappings
+	if _, err := store.BlockRound(99); !errors.Is(err, errors.KeyNotFound) {
+		t.Fatalf("expected KeyNotFound, got %v", err)
+	}
+	if _, err := store.RoundBlock(99); !errors.Is(err, errors.KeyNotFound) {
+		t.Fatalf("expected KeyNotFound, got %v", err)
+	}
+}
+
+func TestResetStore(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer os.RemoveAll(dir)
+
+	//populate every kind of derived data
+	comet := newTestComet(0xAA, 0, 0)
+	if err := store.SetComet(comet); err != nil {
+		t.Fatal(err)
+	}
+	round := types.NewRoundInfo()
+	round.AddEvent(comet.Hex(), true)
+	if err := store.SetRound(0, *round); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetBlock(types.NewBlock(0, 1, [][]byte{[]byte("tx")})); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddConsensusEvent(comet.Hex()); err != nil {
+		t.Fatal(err)
+	}
+
+	newRoots := make(map[string]types.Root)
+	for p := range map[string]int{"0xAA": 0, "0xBB": 1, "0xCC": 2} {
+		root := types.NewBaseRoot()
+		root.Index = 7
+		newRoots[p] = root
+	}
+	if err := store.ResetStore(newRoots); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	//a reload sees none of the stale derived data
+	reloaded, err := LoadBadgerStore(10, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Close()
+
+	if _, err := reloaded.dbGetRound(0); err == nil {
+		t.Fatal("round 0 should be gone")
+	}
+	if _, err := reloaded.dbGetBlock(0); err == nil {
+		t.Fatal("block 0 should be gone")
+	}
+	if _, err := reloaded.Get(topologicalEventKey(0)); err == nil {
+		t.Fatal("topo index should be gone")
+	}
+	if _, err := reloaded.Get(participantEventKey("0xAA", 0)); err == nil {
+		t.Fatal("participant event index should be gone")
+	}
+	if c := reloaded.ConsensusEventsCount(); c != 0 {
+		t.Fatalf("expected 0 consensus events, got %d", c)
+	}
+
+	//the new roots were persisted
+	root, err := reloaded.GetRoot("0xAA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.Index != 7 {
+		t.Fatalf("expected root index 7, got %d", root.Index)
+	}
+}
+
+func TestEventsCount(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	populateEvents(t, store, 5)
+
+	//first call seeds the cache with a scan
+	count, err := store.EventsCount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 5 {
+		t.Fatalf("expected 5 events, got %d", count)
+	}
+
+	//new writes keep the cached count in step with a full scan
+	comet := newTestComet(0xBB, 0, 5)
+	if err := store.SetComet(comet); err != nil {
+		t.Fatal(err)
+	}
+	//a rewrite of an existing event does not double-count
+	if err := store.SetComet(comet); err != nil {
+		t.Fatal(err)
+	}
+
+	count, err = store.EventsCount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := store.DbTopologicalEvents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != len(events) {
+		t.Fatalf("cached count %d does not match scan %d", count, len(events))
+	}
+}
+
+func TestMaxKnownRound(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer os.RemoveAll(dir)
+
+	//empty store
+	max, err := store.MaxKnownRound()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if max != -1 {
+		t.Fatalf("expected -1, got %d", max)
+	}
+
+	for i := 0; i < 4; i++ {
+		round := types.NewRoundInfo()
+		round.AddEvent(fmt.Sprintf("0x%d", i), true)
+		if err := store.SetRound(i, *round); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if max, _ = store.MaxKnownRound(); max != 3 {
+		t.Fatalf("expected 3, got %d", max)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	//after a restart the cache knows nothing, the disk does
+	reloaded, err := LoadBadgerStore(10, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Close()
+
+	if last := reloaded.LastRound(); last != -1 {
+		t.Fatalf("expected a cold LastRound of -1, got %d", last)
+	}
+	if max, err = reloaded.MaxKnownRound(); err != nil || max != 3 {
+		t.Fatalf("expected 3 from disk, got %d (err %v)", max, err)
+	}
+}
+
+func TestForEachParticipantEvent(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	populateEvents(t, store, 6)
+
+	expected, err := store.dbParticipantEvents("0xAA", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//same hashes in the same order as the slice-based accessor
+	visited := []string{}
+	err = store.ForEachParticipantEvent("0xAA", 1, func(hash string) error {
+		visited = append(visited, hash)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(visited) != len(expected) {
+		t.Fatalf("expected %d hashes, got %d", len(expected), len(visited))
+	}
+	for i := range expected {
+		if visited[i] != expected[i] {
+			t.Fatalf("hashes differ at position %d", i)
+		}
+	}
+
+	//early termination
+	visited = visited[:0]
+	err = store.ForEachParticipantEvent("0xAA", -1, func(hash string) error {
+		visited = append(visited, hash)
+		if len(visited) == 2 {
+			return ErrStopIteration
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(visited) != 2 {
+		t.Fatalf("expected 2 hashes, got %d", len(visited))
+	}
+}
+
+func TestRootParentComets(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	x := newTestComet(0xAA, 0, 0)
+	y := newTestComet(0xBB, 0, 0)
+	other := newTestComet(0xCC, 0, 0)
+	for _, comet := range []types.Comet{x, y, other} {
+		if err := store.SetComet(comet); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	roots := map[string]types.Root{
+		"0xAA": {
+			X:      x.Hex(),
+			Y:      y.Hex(),
+			Index:  0,
+			Round:  0,
+			Others: map[string]string{"0xCC": other.Hex()},
+		},
+		"0xBB": types.NewBaseRoot(),
+		"0xCC": types.NewBaseRoot(),
+	}
+	if err := store.Reset(roots); err != nil {
+		t.Fatal(err)
+	}
+
+	parents, err := store.RootParentComets("0xAA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parents) != 3 {
+		t.Fatalf("expected 3 parents, got %d", len(parents))
+	}
+	if parents[0].Hex() != x.Hex() || parents[1].Hex() != y.Hex() || parents[2].Hex() != other.Hex() {
+		t.Fatalf("parents out of order")
+	}
+
+	//a base root has no references
+	baseParents, err := store.RootParentComets("0xBB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(baseParents) != 0 {
+		t.Fatalf("expected no parents for a base root, got %d", len(baseParents))
+	}
+
+	//a dangling reference is aggregated, not fatal
+	roots["0xAA"] = types.Root{X: x.Hex(), Y: "0xMISSING", Index: 0, Round: 0}
+	if err := store.Reset(roots); err != nil {
+		t.Fatal(err)
+	}
+	parents, err = store.RootParentComets("0xAA")
+	if err == nil {
+		t.Fatal("expected aggregated error for missing parent")
+	}
+	if len(parents) != 1 || parents[0].Hex() != x.Hex() {
+		t.Fatalf("expected the readable parent alongside the error")
+	}
+}
+
+func TestGetBlockChecked(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	block := types.NewBlock(0, 1, [][]byte{[]byte("tx1"), []byte("tx2")})
+	if err := store.SetBlock(block); err != nil {
+		t.Fatal(err)
+	}
+
+	checked, err := store.GetBlockChecked(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checked.Index() != block.Index() {
+		t.Fatalf("expected block %d, got %d", block.Index(), checked.Index())
+	}
+
+	//overwrite the stored body with a different, well-formed block so the
+	//corruption only shows up in the hash comparison
+	tampered := types.NewBlock(0, 1, [][]byte{[]byte("evil")})
+	raw, err := tampered.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(blockKey(0), raw); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.GetBlockChecked(0); !errors.Is(err, errors.CorruptValue) {
+		t.Fatalf("expected CorruptValue, got %v", err)
+	}
+
+	//GetBlockChecked on a missing block stays a KeyNotFound
+	if _, err := store.GetBlockChecked(99); !errors.Is(err, errors.KeyNotFound) {
+		t.Fatalf("expected KeyNotFound, got %v", err)
+	}
+}
+
+func TestEventsForBlock(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	base := time.Date(2018, 10, 18, 0, 0, 0, 0, time.UTC)
+
+	mkConsensus := func(creator byte, index, topo, rr int, ts time.Time) types.Comet {
+		comet := newTestComet(creator, index, topo)
+		comet.SetRoundReceived(rr)
+		comet.ConsensusTimestamp = ts
+		return comet
+	}
+
+	second := mkConsensus(0xAA, 0, 0, 1, base)
+	first := mkConsensus(0xBB, 0, 1, 1, base.Add(-time.Second))
+	otherRound := mkConsensus(0xCC, 0, 2, 2, base)
+
+	if err := store.dbSetEvents([]types.Comet{second, first, otherRound}); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := store.EventsForBlock(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+	if events[0].Hex() != first.Hex() || events[1].Hex() != second.Hex() {
+		t.Fatalf("events out of canonical order")
+	}
+
+	//a round-received with no events is empty, not an error
+	empty, err := store.EventsForBlock(9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(empty) != 0 {
+		t.Fatalf("expected no events, got %d", len(empty))
+	}
+}
+
+func TestGetCometInto(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	comets := populateEvents(t, store, 3)
+
+	var dst types.Comet
+	for _, comet := range comets {
+		if err := store.GetCometInto(comet.Hex(), &dst); err != nil {
+			t.Fatal(err)
+		}
+		//dst is overwritten wholesale, nothing from the previous decode leaks
+		if dst.Hex() != comet.Hex() || dst.Index() != comet.Index() {
+			t.Fatalf("expected %s/%d, got %s/%d", comet.Hex(), comet.Index(), dst.Hex(), dst.Index())
+		}
+	}
+
+	if err := store.GetCometInto("0xNOPE", &dst); !errors.Is(err, errors.KeyNotFound) {
+		t.Fatalf("expected KeyNotFound, got %v", err)
+	}
+}
+
+func BenchmarkGetComet(b *testing.B) {
+	store, dir := initBadgerStore(b, 10)
+	defer removeBadgerStore(store, dir)
+
+	comets := populateEvents(b, store, 100)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := store.GetComet(comets[i%len(comets)].Hex()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGetCometInto(b *testing.B) {
+	store, dir := initBadgerStore(b, 10)
+	defer removeBadgerStore(store, dir)
+
+	comets := populateEvents(b, store, 100)
+
+	var dst types.Comet
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := store.GetCometInto(comets[i%len(comets)].Hex(), &dst); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestAddRoundWitnessConcurrent(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	witnesses := []string{"w0", "w1", "w2", "w3"}
+	var wg sync.WaitGroup
+	for _, w := range witnesses {
+		wg.Add(1)
+		go func(w string) {
+			defer wg.Done()
+			if err := store.AddRoundWitness(7, w); err != nil {
+				t.Error(err)
+			}
+		}(w)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := store.AddRoundEvent(7, "e0"); err != nil {
+			t.Error(err)
+		}
+	}()
+	wg.Wait()
+
+	//every concurrent addition survived, in cache and on disk
+	round, err := store.GetRound(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(round.Events) != len(witnesses)+1 {
+		t.Fatalf("expected %d events, got %d", len(witnesses)+1, len(round.Events))
+	}
+	if len(round.Witnesses()) != len(witnesses) {
+		t.Fatalf("expected %d witnesses, got %d", len(witnesses), len(round.Witnesses()))
+	}
+
+	persisted, err := store.dbGetRound(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(persisted.Events) != len(witnesses)+1 {
+		t.Fatalf("expected %d persisted events, got %d", len(witnesses)+1, len(persisted.Events))
+	}
+}
+
+func TestSummary(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	populateEvents(t, store, 4)
+	round := types.NewRoundInfo()
+	round.AddEvent("w0", true)
+	if err := store.SetRound(2, *round); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetBlock(types.NewBlock(1, 2, [][]byte{[]byte("tx")})); err != nil {
+		t.Fatal(err)
+	}
+
+	summary, err := store.Summary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"participants=3", "lastRound=2", "lastBlock=1", "events=4", "dbSize="} {
+		if !strings.Contains(summary, want) {
+			t.Fatalf("summary %q missing %q", summary, want)
+		}
+	}
+}
+
+func TestGetParticipantEventFull(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	comets := populateEvents(t, store, 3)
+
+	comet, hash, err := store.GetParticipantEventFull("0xAA", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != comets[1].Hex() {
+		t.Fatalf("expected hash %s, got %s", comets[1].Hex(), hash)
+	}
+	if comet.Hex() != comets[1].Hex() || comet.Index() != 1 {
+		t.Fatalf("decoded comet does not match the indexed event")
+	}
+
+	if _, _, err := store.GetParticipantEventFull("0xAA", 42); !errors.Is(err, errors.KeyNotFound) {
+		t.Fatalf("expected KeyNotFound, got %v", err)
+	}
+}
+
+func TestDeleteBlocksFrom(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	for i := 0; i < 5; i++ {
+		if err := store.SetBlock(types.NewBlock(i, i+1, [][]byte{[]byte("tx")})); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deleted, err := store.DeleteBlocksFrom(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 3 {
+		t.Fatalf("expected 3 deleted blocks, got %d", deleted)
+	}
+
+	//blocks below the rollback point survive
+	for i := 0; i < 2; i++ {
+		if _, err := store.GetBlock(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	//the tail is gone from cache, db and the derived indexes
+	for i := 2; i < 5; i++ {
+		if _, err := store.GetBlock(i); !errors.Is(err, errors.KeyNotFound) {
+			t.Fatalf("block %d should be gone, got %v", i, err)
+		}
+		if _, err := store.kvGet(blockHashKey(i)); !isDBKeyNotFound(err) {
+			t.Fatalf("blockhash entry %d should be gone", i)
+		}
+		if _, err := store.RoundBlock(i + 1); !errors.Is(err, errors.KeyNotFound) {
+			t.Fatalf("roundblock entry for round %d should be gone", i+1)
+		}
+	}
+
+	last, err := store.LastNBlocks(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(last) != 1 || last[0].Index() != 1 {
+		t.Fatalf("expected last block 1 after rollback")
+	}
+
+	//rolling back past the end is a no-op
+	deleted, err = store.DeleteBlocksFrom(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 0 {
+		t.Fatalf("expected no deletions, got %d", deleted)
+	}
+}
+
+func TestRootsFor(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	roots, err := store.RootsFor([]string{"0xAA", "0xCC"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roots) != 2 {
+		t.Fatalf("expected 2 roots, got %d", len(roots))
+	}
+	for _, p := range []string{"0xAA", "0xCC"} {
+		want, err := store.GetRoot(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if roots[p].Index != want.Index {
+			t.Fatalf("root mismatch for %s", p)
+		}
+	}
+
+	//unknown participants are aggregated, the known roots still come back
+	roots, err = store.RootsFor([]string{"0xBB", "0xNOPE"})
+	if err == nil {
+		t.Fatal("expected an aggregated error for the unknown participant")
+	}
+	if !strings.Contains(err.Error(), "0xNOPE") {
+		t.Fatalf("error should name the unknown participant, got %v", err)
+	}
+	if len(roots) != 1 {
+		t.Fatalf("expected the known root alongside the error, got %d", len(roots))
+	}
+}
+
+func TestChildren(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	parent := newTestComet(0xAA, 0, 0)
+	selfChild := types.NewComet([][]byte{[]byte("tx")}, nil, []string{parent.Hex(), ""}, []byte{0xAA}, 1)
+	selfChild.TopologicalIndex = 1
+	otherChild := types.NewComet([][]byte{[]byte("tx")}, nil, []string{"", parent.Hex()}, []byte{0xBB}, 0)
+	otherChild.TopologicalIndex = 2
+
+	if err := store.dbSetEvents([]types.Comet{parent, selfChild, otherChild}); err != nil {
+		t.Fatal(err)
+	}
+
+	children, err := store.Children(parent.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(children) != 2 {
+		t.Fatalf("expected 2 children, got %d", len(children))
+	}
+	found := map[string]bool{}
+	for _, c := range children {
+		found[c] = true
+	}
+	if !found[selfChild.Hex()] || !found[otherChild.Hex()] {
+		t.Fatalf("expected both children of the shared parent, got %v", children)
+	}
+
+	//a leaf has no children
+	leafChildren, err := store.Children(otherChild.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leafChildren) != 0 {
+		t.Fatalf("expected no children for a leaf, got %d", len(leafChildren))
+	}
+}
+
+func TestParticipantEventCounts(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	//differing counts per creator: 0xAA gets 3 events, 0xBB gets 1, 0xCC none
+	comets := []types.Comet{
+		newTestComet(0xAA, 0, 0),
+		newTestComet(0xBB, 0, 1),
+		newTestComet(0xAA, 1, 2),
+		newTestComet(0xAA, 2, 3),
+	}
+	if err := store.dbSetEvents(comets); err != nil {
+		t.Fatal(err)
+	}
+
+	counts, err := store.ParticipantEventCounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]int{
+		fmt.Sprintf("0x%X", []byte{0xAA}): 3,
+		fmt.Sprintf("0x%X", []byte{0xBB}): 1,
+		fmt.Sprintf("0x%X", []byte{0xCC}): 0,
+	}
+	if len(counts) != len(expected) {
+		t.Fatalf("expected %d participants, got %d", len(expected), len(counts))
+	}
+	for p, c := range expected {
+		if counts[p] != c {
+			t.Fatalf("expected %d events for %s, got %d", c, p, counts[p])
+		}
+	}
+}
+
+func TestFlushCache(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	comet := newTestComet(0xAA, 0, 0)
+	if err := store.SetComet(comet); err != nil {
+		t.Fatal(err)
+	}
+	round := types.NewRoundInfo()
+	round.AddEvent(comet.Hex(), true)
+	if err := store.SetRound(0, *round); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetBlock(types.NewBlock(0, 0, [][]byte{[]byte("tx")})); err != nil {
+		t.Fatal(err)
+	}
+
+	store.FlushCache()
+
+	//everything must still be readable, now through the db fallback
+	if _, err := store.GetComet(comet.Hex()); err != nil {
+		t.Fatalf("expected comet from db after flush, got %v", err)
+	}
+	if _, err := store.GetRound(0); err != nil {
+		t.Fatalf("expected round from db after flush, got %v", err)
+	}
+	if _, err := store.GetBlock(0); err != nil {
+		t.Fatalf("expected block from db after flush, got %v", err)
+	}
+
+	//roots and participants survive the flush
+	if _, err := store.GetRoot(fmt.Sprintf("0x%X", []byte{0xAA})); err != nil {
+		t.Fatalf("expected root after flush, got %v", err)
+	}
+	if p, err := store.Participants(); err != nil || len(p) != 3 {
+		t.Fatalf("expected 3 participants after flush, got %d (%v)", len(p), err)
+	}
+}
+
+func TestRecentEvents(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	//empty store yields an empty slice
+	recent, err := store.RecentEvents(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recent) != 0 {
+		t.Fatalf("expected no events on an empty store, got %d", len(recent))
+	}
+
+	comets := populateEvents(t, store, 20)
+
+	ascending, err := store.DbTopologicalEvents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	recent, err = store.RecentEvents(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recent) != 5 {
+		t.Fatalf("expected 5 events, got %d", len(recent))
+	}
+	for i, comet := range recent {
+		if comet.Hex() != ascending[len(ascending)-1-i].Hex() {
+			t.Fatalf("recent order broken at position %d", i)
+		}
+	}
+
+	//a limit past the store size returns everything, still newest-first
+	recent, err = store.RecentEvents(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recent) != len(comets) {
+		t.Fatalf("expected %d events, got %d", len(comets), len(recent))
+	}
+}
+
+func TestRefreshFromDisk(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	participant := fmt.Sprintf("0x%X", []byte{0xAA})
+
+	//modify the root on disk behind the cache's back
+	modified := types.NewBaseRoot()
+	modified.Index = 42
+	if err := store.dbSetRoots(map[string]types.Root{participant: modified}); err != nil {
+		t.Fatal(err)
+	}
+
+	//the cached copy is stale until the refresh
+	root, err := store.GetRoot(participant)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.Index == 42 {
+		t.Fatal("expected the cached root to be stale before refresh")
+	}
+
+	if err := store.RefreshFromDisk(); err != nil {
+		t.Fatal(err)
+	}
+	root, err = store.GetRoot(participant)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.Index != 42 {
+		t.Fatalf("expected refreshed root index 42, got %d", root.Index)
+	}
+	if p, err := store.Participants(); err != nil || len(p) != 3 {
+		t.Fatalf("expected 3 participants after refresh, got %d (%v)", len(p), err)
+	}
+}
+
+func benchRootStore(b *testing.B) (*BadgerStore, string) {
+	dir, err := ioutil.TempDir("", "badger")
+	if err != nil {
+		b.Fatal(err)
+	}
+	participants := make(map[string]int)
+	for i := 0; i < 100; i++ {
+		participants[fmt.Sprintf("0x%X", []byte{byte(i), byte(i >> 8)})] = i
+	}
+	store, err := NewBadgerStore(participants, 10, dir)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return store, dir
+}
+
+//the per-participant strategy LoadBadgerStore used before dbGetAllRoots
+func BenchmarkAllRootsPerView(b *testing.B) {
+	store, dir := benchRootStore(b)
+	defer removeBadgerStore(store, dir)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for p := range store.participants {
+			if _, err := store.dbGetRoot(p); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkAllRootsBatched(b *testing.B) {
+	store, dir := benchRootStore(b)
+	defer removeBadgerStore(store, dir)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := store.dbGetAllRoots(store.participants); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestStoreComet(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	for i := 0; i < 3; i++ {
+		comet := newTestComet(0xAA, i, i)
+		topoIndex, err := store.StoreComet(comet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if topoIndex != i {
+			t.Fatalf("expected topo index %d, got %d", i, topoIndex)
+		}
+	}
+
+	ordered, err := store.DbTopologicalEvents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ordered) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(ordered))
+	}
+	for i, comet := range ordered {
+		if comet.TopologicalIndex != i {
+			t.Fatalf("expected topo index %d at position %d, got %d", i, i, comet.TopologicalIndex)
+		}
+	}
+}
+
+func TestRoundBytes(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	round := types.NewRoundInfo()
+	round.AddEvent("0xEVENT", true)
+	raw, err := round.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.SetRoundBytes(0, raw); err != nil {
+		t.Fatal(err)
+	}
+
+	//raw bytes round-trip untouched
+	got, err := store.GetRoundBytes(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, raw) {
+		t.Fatal("raw round bytes do not round-trip")
+	}
+
+	//a typed read of raw-written data decodes correctly
+	decoded, err := store.GetRound(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	witnesses := decoded.Witnesses()
+	if len(witnesses) != 1 || witnesses[0] != "0xEVENT" {
+		t.Fatalf("expected witness 0xEVENT, got %v", witnesses)
+	}
+
+	//a missing round yields a KeyNotFound error
+	if _, err := store.GetRoundBytes(5); !errors.Is(err, errors.KeyNotFound) {
+		t.Fatalf("expected KeyNotFound for missing round, got %v", err)
+	}
+}
+
+func TestConsensusComets(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	comets := populateEvents(t, store, 5)
+	for _, comet := range comets {
+		if err := store.AddConsensusEvent(comet.Hex()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	decoded, err := store.ConsensusComets(1, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 3 {
+		t.Fatalf("expected 3 comets, got %d", len(decoded))
+	}
+	for i, comet := range decoded {
+		if comet.Hex() != comets[i+1].Hex() {
+			t.Fatalf("consensus order broken at position %d", i)
+		}
+	}
+
+	//out-of-range windows are clamped to the stored range
+	decoded, err = store.ConsensusComets(-5, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != len(comets) {
+		t.Fatalf("expected %d comets for a clamped window, got %d", len(comets), len(decoded))
+	}
+}
+
+func TestVerifyParticipants(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	expected, err := store.Participants()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.VerifyParticipants(expected); err != nil {
+		t.Fatalf("expected matching sets to verify, got %v", err)
+	}
+
+	//missing: the expected set has a pubkey the store does not
+	withMissing := map[string]int{}
+	for p, id := range expected {
+		withMissing[p] = id
+	}
+	withMissing["0xDD"] = 99
+	err = store.VerifyParticipants(withMissing)
+	if err == nil || !strings.Contains(err.Error(), "missing [0xDD]") {
+		t.Fatalf("expected missing-participant error, got %v", err)
+	}
+
+	//extra: the store has a pubkey the expected set does not
+	withExtra := map[string]int{}
+	for p, id := range expected {
+		withExtra[p] = id
+	}
+	aa := fmt.Sprintf("0x%X", []byte{0xAA})
+	delete(withExtra, aa)
+	err = store.VerifyParticipants(withExtra)
+	if err == nil || !strings.Contains(err.Error(), "extra ["+aa+"]") {
+		t.Fatalf("expected extra-participant error, got %v", err)
+	}
+
+	//id mismatch
+	withMismatch := map[string]int{}
+	for p, id := range expected {
+		withMismatch[p] = id + 1
+	}
+	err = store.VerifyParticipants(withMismatch)
+	if err == nil || !strings.Contains(err.Error(), "id mismatch") {
+		t.Fatalf("expected id-mismatch error, got %v", err)
+	}
+}
+
+func TestEventDepth(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	//a small DAG: a0 and b0 are root-anchored, a1 builds on both, b1 on a1
+	a0 := newTestComet(0xAA, 0, 0)
+	b0 := newTestComet(0xBB, 0, 1)
+	a1 := types.NewComet([][]byte{[]byte("tx")}, nil, []string{a0.Hex(), b0.Hex()}, []byte{0xAA}, 1)
+	a1.TopologicalIndex = 2
+	b1 := types.NewComet([][]byte{[]byte("tx")}, nil, []string{b0.Hex(), a1.Hex()}, []byte{0xBB}, 1)
+	b1.TopologicalIndex = 3
+	if err := store.dbSetEvents([]types.Comet{a0, b0, a1, b1}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]int{a0.Hex(): 0, b0.Hex(): 0, a1.Hex(): 1, b1.Hex(): 2}
+	for hash, want := range expected {
+		depth, err := store.EventDepth(hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if depth != want {
+			t.Fatalf("expected depth %d for %s, got %d", want, hash, depth)
+		}
+	}
+
+	//a second query is served from the memoization cache
+	if depth, err := store.EventDepth(b1.Hex()); err != nil || depth != 2 {
+		t.Fatalf("expected memoized depth 2, got %d (%v)", depth, err)
+	}
+
+	if _, err := store.EventDepth("0xUNKNOWN"); !errors.Is(err, errors.KeyNotFound) {
+		t.Fatalf("expected KeyNotFound for an unknown event, got %v", err)
+	}
+}
+
+func TestViewReadTxn(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	comets := populateEvents(t, store, 3)
+	round := types.NewRoundInfo()
+	round.AddEvent(comets[0].Hex(), true)
+	if err := store.SetRound(0, *round); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetBlock(types.NewBlock(0, 0, [][]byte{[]byte("tx")})); err != nil {
+		t.Fatal(err)
+	}
+
+	//flush the cache so the db path of each typed getter is exercised too
+	store.FlushCache()
+
+	err := store.View(func(r ReadTxn) error {
+		for _, comet := range comets {
+			got, err := r.GetComet(comet.Hex())
+			if err != nil {
+				return err
+			}
+			if got.Hex() != comet.Hex() {
+				t.Fatalf("comet mismatch for %s", comet.Hex())
+			}
+		}
+		if _, err := r.GetRound(0); err != nil {
+			return err
+		}
+		if _, err := r.GetBlock(0); err != nil {
+			return err
+		}
+		if _, err := r.GetRoot(fmt.Sprintf("0x%X", []byte{0xAA})); err != nil {
+			return err
+		}
+		//a missing key carries the typed error through the shared txn
+		if _, err := r.GetBlock(9); !errors.Is(err, errors.KeyNotFound) {
+			t.Fatalf("expected KeyNotFound through ReadTxn, got %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLastEventFromColdStore(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer os.RemoveAll(dir)
+
+	comets := populateEvents(t, store, 5)
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	//reload without warming: the in-memory window is empty
+	reloaded, err := LoadBadgerStore(10, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Close()
+
+	participant := fmt.Sprintf("0x%X", []byte{0xAA})
+	last, isRoot, err := reloaded.LastEventFrom(participant)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if isRoot {
+		t.Fatal("expected the last event to come from the db, not the root")
+	}
+	if last != comets[4].Hex() {
+		t.Fatalf("expected last event %s, got %s", comets[4].Hex(), last)
+	}
+
+	//a participant without events still reports its root
+	_, isRoot, err = reloaded.LastEventFrom(fmt.Sprintf("0x%X", []byte{0xBB}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isRoot {
+		t.Fatal("expected a participant without events to report its root")
+	}
+
+	//KnownEvents resolves the cold-start index through the same path
+	participants, err := reloaded.Participants()
+	if err != nil {
+		t.Fatal(err)
+	}
+	known := reloaded.KnownEvents()
+	if known[participants[participant]] != 4 {
+		t.Fatalf("expected known index 4, got %d", known[participants[participant]])
+	}
+}
+
+func TestWriteMirror(t *testing.T) {
+	primary, primaryDir := initBadgerStore(t, 10)
+	defer removeBadgerStore(primary, primaryDir)
+	secondary, secondaryDir := initBadgerStore(t, 10)
+	defer removeBadgerStore(secondary, secondaryDir)
+
+	primary.WriteMirror(secondary, nil)
+
+	comet := newTestComet(0xAA, 0, 0)
+	if err := primary.SetComet(comet); err != nil {
+		t.Fatal(err)
+	}
+	round := types.NewRoundInfo()
+	round.AddEvent(comet.Hex(), true)
+	if err := primary.SetRound(0, *round); err != nil {
+		t.Fatal(err)
+	}
+	if err := primary.SetBlock(types.NewBlock(0, 0, [][]byte{[]byte("tx")})); err != nil {
+		t.Fatal(err)
+	}
+
+	//the secondary received all three mirrored writes
+	if _, err := secondary.GetComet(comet.Hex()); err != nil {
+		t.Fatalf("expected mirrored comet on the secondary, got %v", err)
+	}
+	if _, err := secondary.GetRound(0); err != nil {
+		t.Fatalf("expected mirrored round on the secondary, got %v", err)
+	}
+	if _, err := secondary.GetBlock(0); err != nil {
+		t.Fatalf("expected mirrored block on the secondary, got %v", err)
+	}
+
+	//removing the mirror stops replication
+	primary.WriteMirror(nil, nil)
+	if err := primary.SetBlock(types.NewBlock(1, 1, [][]byte{[]byte("tx")})); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := secondary.GetBlock(1); err == nil {
+		t.Fatal("expected no mirrored block after the mirror was removed")
+	}
+}
+
+func TestMissingRoundSurfacesKeyNotFound(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	//the db layer reports the real error, not a silent empty RoundInfo
+	if _, err := store.dbGetRound(3); !isDBKeyNotFound(err) {
+		t.Fatalf("expected badger KeyNotFound from dbGetRound, got %v", err)
+	}
+	if _, err := store.GetRound(3); !errors.Is(err, errors.KeyNotFound) {
+		t.Fatalf("expected KeyNotFound from GetRound, got %v", err)
+	}
+
+	//a stored empty round is still distinguishable from a missing one
+	if err := store.SetRound(3, *types.NewRoundInfo()); err != nil {
+		t.Fatal(err)
+	}
+	round, err := store.dbGetRound(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(round.Events) != 0 {
+		t.Fatalf("expected an empty round, got %d events", len(round.Events))
+	}
+}
+
+func TestBlockSignatureCount(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	//no signatures collected yet
+	if c, err := store.BlockSignatureCount(0); err != nil || c != 0 {
+		t.Fatalf("expected 0 signatures, got %d (%v)", c, err)
+	}
+
+	validators := [][]byte{{0xAA}, {0xBB}, {0xCC}}
+	for i, v := range validators {
+		sig := types.BlockSignature{Validator: v, Index: 0, Signature: fmt.Sprintf("sig%d", i)}
+		if err := store.AddBlockSignature(sig); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if c, err := store.BlockSignatureCount(0); err != nil || c != 3 {
+		t.Fatalf("expected 3 signatures, got %d (%v)", c, err)
+	}
+
+	//a repeated signature from the same validator does not double-count
+	dup := types.BlockSignature{Validator: []byte{0xAA}, Index: 0, Signature: "sig0bis"}
+	if err := store.AddBlockSignature(dup); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := store.BlockSignatureCount(0); err != nil || c != 3 {
+		t.Fatalf("expected 3 signatures after a duplicate, got %d (%v)", c, err)
+	}
+
+	//signatures are counted per block
+	other := types.BlockSignature{Validator: []byte{0xAA}, Index: 1, Signature: "sig"}
+	if err := store.AddBlockSignature(other); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := store.BlockSignatureCount(1); err != nil || c != 1 {
+		t.Fatalf("expected 1 signature for block 1, got %d (%v)", c, err)
+	}
+}
+
+func TestOrphanEvents(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	//a0 is root-anchored, a1 builds on it, but b1's other-parent is absent
+	a0 := newTestComet(0xAA, 0, 0)
+	a1 := types.NewComet([][]byte{[]byte("tx")}, nil, []string{a0.Hex(), ""}, []byte{0xAA}, 1)
+	a1.TopologicalIndex = 1
+	missing := newTestComet(0xBB, 0, 99)
+	b1 := types.NewComet([][]byte{[]byte("tx")}, nil, []string{missing.Hex(), a1.Hex()}, []byte{0xBB}, 1)
+	b1.TopologicalIndex = 2
+	if err := store.dbSetEvents([]types.Comet{a0, a1, b1}); err != nil {
+		t.Fatal(err)
+	}
+
+	orphans, err := store.OrphanEvents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orphans) != 1 || orphans[0] != b1.Hex() {
+		t.Fatalf("expected orphan [%s], got %v", b1.Hex(), orphans)
+	}
+
+	//storing the missing parent resolves the orphan
+	if err := store.dbSetEvents([]types.Comet{missing}); err != nil {
+		t.Fatal(err)
+	}
+	orphans, err = store.OrphanEvents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orphans) != 0 {
+		t.Fatalf("expected no orphans after the parent arrived, got %v", orphans)
+	}
+}
+
+func TestBulkLoadComets(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	comets := make([]types.Comet, 50)
+	for i := range comets {
+		comets[i] = newTestComet(0xAA, i, i)
+	}
+	if err := store.BulkLoadComets(comets); err != nil {
+		t.Fatal(err)
+	}
+
+	ordered, err := store.DbTopologicalEvents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ordered) != len(comets) {
+		t.Fatalf("expected %d events, got %d", len(comets), len(ordered))
+	}
+	if c, err := store.EventsCount(); err != nil || c != len(comets) {
+		t.Fatalf("expected events count %d, got %d (%v)", len(comets), c, err)
+	}
+}
+
+func benchComets(n int) []types.Comet {
+	comets := make([]types.Comet, n)
+	for i := range comets {
+		comets[i] = newTestComet(0xAA, i, i)
+	}
+	return comets
+}
+
+func BenchmarkBulkLoadProbed(b *testing.B) {
+	comets := benchComets(1000)
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		store, dir := initBadgerStore(b, 10)
+		b.StartTimer()
+		if err := store.dbSetEvents(comets); err != nil {
+			b.Fatal(err)
+		}
+		b.StopTimer()
+		removeBadgerStore(store, dir)
+		b.StartTimer()
+	}
+}
+
+func BenchmarkBulkLoadBlind(b *testing.B) {
+	comets := benchComets(1000)
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		store, dir := initBadgerStore(b, 10)
+		b.StartTimer()
+		if err := store.BulkLoadComets(comets); err != nil {
+			b.Fatal(err)
+		}
+		b.StopTimer()
+		removeBadgerStore(store, dir)
+		b.StartTimer()
+	}
+}
+
+func TestEventParents(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	a0 := newTestComet(0xAA, 0, 0)
+	b0 := newTestComet(0xBB, 0, 1)
+	a1 := types.NewComet([][]byte{[]byte("tx")}, nil, []string{a0.Hex(), b0.Hex()}, []byte{0xAA}, 1)
+	a1.TopologicalIndex = 2
+	if err := store.dbSetEvents([]types.Comet{a0, b0, a1}); err != nil {
+		t.Fatal(err)
+	}
+
+	selfParent, otherParent, err := store.EventParents(a1.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if selfParent.Hex() != a0.Hex() {
+		t.Fatalf("expected self-parent %s, got %s", a0.Hex(), selfParent.Hex())
+	}
+	if otherParent.Hex() != b0.Hex() {
+		t.Fatalf("expected other-parent %s, got %s", b0.Hex(), otherParent.Hex())
+	}
+
+	//a root-anchored event has no self-parent
+	_, _, err = store.EventParents(a0.Hex())
+	if !errors.Is(err, errors.KeyNotFound) || !strings.Contains(err.Error(), "selfparent") {
+		t.Fatalf("expected selfparent KeyNotFound for a root-anchored event, got %v", err)
+	}
+
+	//a missing other-parent is reported with its side
+	missing := newTestComet(0xCC, 5, 99)
+	b1 := types.NewComet([][]byte{[]byte("tx")}, nil, []string{b0.Hex(), missing.Hex()}, []byte{0xBB}, 1)
+	b1.TopologicalIndex = 3
+	if err := store.dbSetEvents([]types.Comet{b1}); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = store.EventParents(b1.Hex())
+	if !errors.Is(err, errors.KeyNotFound) || !strings.Contains(err.Error(), "otherparent") {
+		t.Fatalf("expected otherparent KeyNotFound, got %v", err)
+	}
+}
+
+func TestTopologicalCursor(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	comets := populateEvents(t, store, 25)
+
+	full, err := store.DbTopologicalEvents()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cursor, err := store.OpenTopologicalCursor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cursor.Close()
+
+	paged := []types.Comet{}
+	for {
+		page, err := cursor.Next(7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page) == 0 {
+			break
+		}
+		paged = append(paged, page...)
+	}
+	if len(paged) != len(comets) {
+		t.Fatalf("expected %d events via cursor, got %d", len(comets), len(paged))
+	}
+	for i := range full {
+		if paged[i].Hex() != full[i].Hex() {
+			t.Fatalf("cursor order diverges from full scan at position %d", i)
+		}
+	}
+}
+
+func TestGetRoundSeesCommittedWitnesses(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	//every completed AddRoundWitness must be visible to the very next
+	//GetRound from the same goroutine, whatever the other writers do
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				w := fmt.Sprintf("w%d_%d", g, i)
+				if err := store.AddRoundWitness(0, w); err != nil {
+					errs <- err
+					return
+				}
+				round, err := store.GetRound(0)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if _, ok := round.Events[w]; !ok {
+					errs <- fmt.Errorf("witness %s lost after commit", w)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	round, err := store.GetRound(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(round.Witnesses()) != 40 {
+		t.Fatalf("expected 40 witnesses, got %d", len(round.Witnesses()))
+	}
+}
+
+func TestBlockStateHash(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	block := types.NewBlock(0, 1, [][]byte{[]byte("tx")})
+	block.Body.StateHash = []byte("stateroot")
+	if err := store.SetBlock(block); err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := store.BlockStateHash(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := store.GetBlock(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(hash, stored.StateHash()) {
+		t.Fatalf("expected state hash %q, got %q", stored.StateHash(), hash)
+	}
+
+	if _, err := store.BlockStateHash(7); !errors.Is(err, errors.KeyNotFound) {
+		t.Fatalf("expected KeyNotFound for a missing block, got %v", err)
+	}
+}
+
+func TestIsWitness(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	witness := newTestComet(0xAA, 0, 0)
+	regular := newTestComet(0xBB, 0, 1)
+	unrounded := newTestComet(0xCC, 0, 2)
+	for _, c := range []types.Comet{witness, regular, unrounded} {
+		if err := store.SetComet(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	round := types.NewRoundInfo()
+	round.AddEvent(witness.Hex(), true)
+	round.AddEvent(regular.Hex(), false)
+	if err := store.SetRound(0, *round); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, err := store.IsWitness(witness.Hex()); err != nil || !ok {
+		t.Fatalf("expected witness, got %v, %v", ok, err)
+	}
+	if ok, err := store.IsWitness(regular.Hex()); err != nil || ok {
+		t.Fatalf("expected non-witness, got %v, %v", ok, err)
+	}
+	if ok, err := store.IsWitness(unrounded.Hex()); err != nil || ok {
+		t.Fatalf("expected false for an event in no round, got %v, %v", ok, err)
+	}
+	if _, err := store.IsWitness("0xNOPE"); !errors.Is(err, errors.KeyNotFound) {
+		t.Fatalf("expected KeyNotFound for an unknown event, got %v", err)
+	}
+}
+
+func TestCrashHook(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	crash := fmt.Errorf("simulated crash")
+	var lastPoint string
+	store.crashHook = func(point string) error {
+		lastPoint = point
+		return crash
+	}
+
+	comet := newTestComet(0xAA, 0, 0)
+	if err := store.SetComet(comet); err != crash {
+		t.Fatalf("expected the injected crash, got %v", err)
+	}
+	if lastPoint != "setcomet:pre-db" {
+		t.Fatalf("expected crash at setcomet:pre-db, got %q", lastPoint)
+	}
+	//the cache was updated, the db was not: exactly the torn state a crash
+	//between the two would leave
+	if _, err := store.inmemStore.GetComet(comet.Hex()); err != nil {
+		t.Fatalf("expected the event in the cache, got %v", err)
+	}
+	if _, err := store.dbGetEvent(comet.Hex()); err == nil {
+		t.Fatal("expected the event to be missing from the db")
+	}
+
+	//a batch aborted at its crash point leaves nothing on disk: the db write
+	//is a single transaction, so there is no partial subset to leak
+	batch := []types.Comet{
+		newTestComet(0xBB, 0, 1),
+		newTestComet(0xBB, 1, 2),
+	}
+	if err := store.BatchSetComets(batch); err != crash {
+		t.Fatalf("expected the injected crash, got %v", err)
+	}
+	for _, c := range batch {
+		if _, err := store.dbGetEvent(c.Hex()); err == nil {
+			t.Fatalf("expected event %s to be missing from the db", c.Hex())
+		}
+	}
+
+	block := types.NewBlock(0, 1, [][]byte{[]byte("tx")})
+	if err := store.SetBlock(block); err != crash {
+		t.Fatalf("expected the injected crash, got %v", err)
+	}
+	if _, err := store.dbGetBlock(0); err == nil {
+		t.Fatal("expected the block to be missing from the db")
+	}
+
+	//recovery discards the torn cache state
+	store.crashHook = nil
+	if err := store.RefreshFromDisk(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GetComet(comet.Hex()); err == nil {
+		t.Fatal("expected the crashed event to be gone after refresh")
+	}
+}
+
+func TestGenesisRoot(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	genesis, err := store.GenesisRoot("0xAA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := types.NewBaseRoot()
+	if genesis.X != base.X || genesis.Index != base.Index {
+		t.Fatalf("expected the base root as genesis, got %+v", genesis)
+	}
+
+	//advance the working root, as a reset would
+	advanced := types.Root{X: "0xHEAD", Y: "0xOTHER", Index: 5, Round: 2}
+	if err := store.dbSetRoots(map[string]types.Root{"0xAA": advanced}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := store.dbGetRoot("0xAA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Index != 5 {
+		t.Fatalf("expected the working root to advance, got %+v", got)
+	}
+	genesis, err = store.GenesisRoot("0xAA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if genesis.Index != base.Index || genesis.X != base.X {
+		t.Fatalf("expected the genesis root to be unchanged, got %+v", genesis)
+	}
+
+	if _, err := store.GenesisRoot("0xNOBODY"); !errors.Is(err, errors.KeyNotFound) {
+		t.Fatalf("expected KeyNotFound for an unknown participant, got %v", err)
+	}
+}
+
+func TestSetCometWithTTL(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	comet := newTestComet(0xAA, 0, 0)
+	if err := store.SetCometWithTTL(comet, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	//present before expiry, via the db since the cache is skipped
+	if _, err := store.GetComet(comet.Hex()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.EventTopoIndex(comet.Hex()); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(1200 * time.Millisecond)
+
+	//the event and its index entries expire together
+	if _, err := store.GetComet(comet.Hex()); !errors.Is(err, errors.KeyNotFound) {
+		t.Fatalf("expected KeyNotFound after expiry, got %v", err)
+	}
+	if _, err := store.EventTopoIndex(comet.Hex()); !errors.Is(err, errors.KeyNotFound) {
+		t.Fatalf("expected the topo index entry to expire, got %v", err)
+	}
+	if _, err := store.dbParticipantEvent("0xAA", 0); err == nil {
+		t.Fatal("expected the participant index entry to expire")
+	}
+}
+
+func TestForEachRoundEvent(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	round := types.NewRoundInfo()
+	for i := 0; i < 5; i++ {
+		comet := newTestComet(0xAA, i, i)
+		if err := store.SetComet(comet); err != nil {
+			t.Fatal(err)
+		}
+		round.AddEvent(comet.Hex(), i == 0)
+	}
+	if err := store.SetRound(0, *round); err != nil {
+		t.Fatal(err)
+	}
+
+	//the streaming walk visits the same events in the same order as the
+	//slice variant
+	want, err := store.RoundEventComets(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []types.Comet{}
+	err = store.ForEachRoundEvent(0, func(comet types.Comet) error {
+		got = append(got, comet)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d events, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if got[i].Hex() != want[i].Hex() {
+			t.Fatalf("order mismatch at %d: %s vs %s", i, got[i].Hex(), want[i].Hex())
+		}
+	}
+
+	//ErrStopIteration ends the walk early without an error
+	visited := 0
+	err = store.ForEachRoundEvent(0, func(types.Comet) error {
+		visited++
+		if visited == 2 {
+			return ErrStopIteration
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if visited != 2 {
+		t.Fatalf("expected 2 visited events, got %d", visited)
+	}
+
+	//a callback error aborts and propagates
+	boom := fmt.Errorf("boom")
+	if err := store.ForEachRoundEvent(0, func(types.Comet) error { return boom }); err != boom {
+		t.Fatalf("expected the callback error, got %v", err)
+	}
+
+	if err := store.ForEachRoundEvent(9, func(types.Comet) error { return nil }); !errors.Is(err, errors.KeyNotFound) {
+		t.Fatalf("expected KeyNotFound for a missing round, got %v", err)
+	}
+}
+
+func TestLastApplied(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer func() {
+		os.RemoveAll(dir)
+	}()
+
+	//unset defaults to -1
+	if last, err := store.LastApplied(); err != nil || last != -1 {
+		t.Fatalf("expected -1 for an unset marker, got %d, %v", last, err)
+	}
+
+	if err := store.SetLastApplied(3); err != nil {
+		t.Fatal(err)
+	}
+	if last, err := store.LastApplied(); err != nil || last != 3 {
+		t.Fatalf("expected 3, got %d, %v", last, err)
+	}
+
+	//the marker survives a restart
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := LoadBadgerStore(10, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Close()
+
+	if last, err := reloaded.LastApplied(); err != nil || last != 3 {
+		t.Fatalf("expected the marker to survive a reload, got %d, %v", last, err)
+	}
+}
+
+func TestEventsByTimeRange(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	base := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	comets := make([]types.Comet, 4)
+	for i := range comets {
+		comets[i] = newTestComet(0xAA, i, i)
+		comets[i].Body.Timestamp = base.Add(time.Duration(i) * time.Second)
+	}
+	//two events sharing one timestamp must both be indexed
+	twin := newTestComet(0xBB, 0, 4)
+	twin.Body.Timestamp = comets[2].Body.Timestamp
+	if err := store.dbSetEvents(append(comets, twin)); err != nil {
+		t.Fatal(err)
+	}
+
+	//a sub-window is inclusive on both ends
+	from := base.Add(time.Second).UnixNano()
+	to := base.Add(2 * time.Second).UnixNano()
+	hashes, err := store.EventsByTimeRange(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hashes) != 3 {
+		t.Fatalf("expected 3 events in the window, got %d: %v", len(hashes), hashes)
+	}
+	want := map[string]bool{comets[1].Hex(): true, comets[2].Hex(): true, twin.Hex(): true}
+	for _, h := range hashes {
+		if !want[h] {
+			t.Fatalf("unexpected event %s in the window", h)
+		}
+	}
+	//oldest first
+	if hashes[0] != comets[1].Hex() {
+		t.Fatalf("expected the window to start with the oldest event, got %s", hashes[0])
+	}
+
+	//an empty window yields an empty slice
+	if hashes, err := store.EventsByTimeRange(to+1, to+2); err != nil || len(hashes) != 0 {
+		t.Fatalf("expected an empty window, got %v, %v", hashes, err)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+	other, otherDir := initBadgerStore(t, 10)
+	defer removeBadgerStore(other, otherDir)
+
+	//two fresh stores with the same participants agree
+	fp1, err := store.Fingerprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp2, err := other.Fingerprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(fp1, fp2) {
+		t.Fatal("expected identical stores to share a fingerprint")
+	}
+
+	//advancing the head on one side diverges the fingerprints
+	if err := store.SetBlock(types.NewBlock(0, 1, [][]byte{[]byte("tx")})); err != nil {
+		t.Fatal(err)
+	}
+	diverged, err := store.Fingerprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(diverged, fp2) {
+		t.Fatal("expected a new block to change the fingerprint")
+	}
+
+	//catching the other store up re-aligns them
+	if err := other.SetBlock(types.NewBlock(0, 1, [][]byte{[]byte("tx")})); err != nil {
+		t.Fatal(err)
+	}
+	caughtUp, err := other.Fingerprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(diverged, caughtUp) {
+		t.Fatal("expected caught-up stores to share a fingerprint")
+	}
+
+	//a new round moves the fingerprint too
+	round := types.NewRoundInfo()
+	round.AddEvent("0xW", true)
+	if err := store.SetRound(0, *round); err != nil {
+		t.Fatal(err)
+	}
+	withRound, err := store.Fingerprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(withRound, diverged) {
+		t.Fatal("expected a new round to change the fingerprint")
+	}
+}
+
+func TestReconstructBlock(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	base := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		comet := newTestComet(0xAA, i, i)
+		comet.SetRoundReceived(1)
+		comet.ConsensusTimestamp = base.Add(time.Duration(i) * time.Second)
+		if err := store.SetComet(comet); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	//build the block the way the block builder would
+	events, err := store.EventsForBlock(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transactions := [][]byte{}
+	for _, ev := range events {
+		transactions = append(transactions, ev.Transactions()...)
+	}
+	original := types.NewBlock(0, 1, transactions)
+	if err := store.SetBlock(original); err != nil {
+		t.Fatal(err)
+	}
+
+	//wipe the block record, keeping the round<->block mapping and events
+	tx := store.db.NewTransaction(true)
+	if err := tx.Delete(blockKey(0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+	store.FlushCache()
+	if _, err := store.GetBlock(0); !errors.Is(err, errors.KeyNotFound) {
+		t.Fatalf("expected the block to be gone, got %v", err)
+	}
+
+	rebuilt, err := store.ReconstructBlock(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rebuilt.Hex() != original.Hex() {
+		t.Fatalf("expected the rebuilt block to match, got %s vs %s", rebuilt.Hex(), original.Hex())
+	}
+
+	//the rebuilt block was re-persisted
+	store.FlushCache()
+	if _, err := store.GetBlock(0); err != nil {
+		t.Fatalf("expected the block to be healed on disk, got %v", err)
+	}
+
+	//a present block is returned as-is, a hopeless one stays missing
+	if _, err := store.ReconstructBlock(0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.ReconstructBlock(9); !errors.Is(err, errors.KeyNotFound) {
+		t.Fatalf("expected KeyNotFound for an unreconstructible block, got %v", err)
+	}
+}
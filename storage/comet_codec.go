@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/paradigm-network/paradigm/types"
+)
+
+//cometCodec converts comets to and from their stored representation. The
+//name of the codec used to write a store is recorded under the codec key so
+//a store is never read back with the wrong one.
+type cometCodec interface {
+	Name() string
+	Marshal(comet *types.Comet) ([]byte, error)
+	Unmarshal(data []byte, comet *types.Comet) error
+}
+
+//defaultCodec is the compact encoding types.Comet has always used
+type defaultCodec struct{}
+
+func (defaultCodec) Name() string { return "default" }
+
+func (defaultCodec) Marshal(comet *types.Comet) ([]byte, error) {
+	return comet.Marshal()
+}
+
+func (defaultCodec) Unmarshal(data []byte, comet *types.Comet) error {
+	return comet.Unmarshal(data)
+}
+
+//jsonCodec stores comets as indented JSON so a dev network's database can be
+//inspected with standard tools, trading size for readability
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string { return "json" }
+
+func (jsonCodec) Marshal(comet *types.Comet) ([]byte, error) {
+	return json.MarshalIndent(comet, "", "  ")
+}
+
+func (jsonCodec) Unmarshal(data []byte, comet *types.Comet) error {
+	return json.Unmarshal(data, comet)
+}
+
+func codecByName(name string) (cometCodec, error) {
+	switch name {
+	case "", "default":
+		return defaultCodec{}, nil
+	case "json":
+		return jsonCodec{}, nil
+	}
+	return nil, fmt.Errorf("unknown comet codec %s", name)
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func testCodecRoundTrip(t *testing.T, conf *StoreConfig) *BadgerStore {
+	store, dir := initConfiguredBadgerStore(t, conf)
+	defer removeBadgerStore(store, dir)
+
+	comet := newTestComet(0xAA, 0, 0)
+	if err := store.SetComet(comet); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := store.dbGetEvent(comet.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Hex() != comet.Hex() || got.Creator() != comet.Creator() || got.Index() != comet.Index() {
+		t.Fatalf("round trip mismatch: %+v vs %+v", got, comet)
+	}
+	return store
+}
+
+func TestDefaultCodecRoundTrip(t *testing.T) {
+	testCodecRoundTrip(t, DefaultStoreConfig())
+}
+
+func TestJSONCodecRoundTrip(t *testing.T) {
+	testCodecRoundTrip(t, &StoreConfig{Codec: "json"})
+}
+
+func TestJSONCodecIsInspectable(t *testing.T) {
+	store, dir := initConfiguredBadgerStore(t, &StoreConfig{Codec: "json"})
+	defer removeBadgerStore(store, dir)
+
+	comet := newTestComet(0xAA, 0, 0)
+	if err := store.SetComet(comet); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := store.Get([]byte(comet.Hex()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(raw, []byte("\n  \"Body\"")) {
+		t.Fatalf("expected indented JSON, got %s", raw)
+	}
+}
+
+func TestCodecRecordedInSchema(t *testing.T) {
+	store, dir := initConfiguredBadgerStore(t, &StoreConfig{Codec: "json"})
+	defer os.RemoveAll(dir)
+
+	comet := newTestComet(0xAA, 0, 0)
+	if err := store.SetComet(comet); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	//a reload adopts the recorded codec without being told
+	reloaded, err := LoadBadgerStore(10, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Close()
+
+	if name := reloaded.codec.Name(); name != "json" {
+		t.Fatalf("expected json codec, got %s", name)
+	}
+	if _, err := reloaded.dbGetEvent(comet.Hex()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUnknownCodecRejected(t *testing.T) {
+	if _, err := codecByName("msgpack"); err == nil {
+		t.Fatal("unknown codec should be rejected")
+	}
+}
@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/dgraph-io/badger"
+	"github.com/paradigm-network/paradigm/types"
+)
+
+//StoreDiff is the result of CompareStores. Keys are the raw database keys
+//(block_xxx, round_xxx, event hashes) so entries are self-describing.
+type StoreDiff struct {
+	ParticipantsEqual bool
+	MissingInA        []string //present in b only
+	MissingInB        []string //present in a only
+	Mismatched        []string //present in both with different content
+}
+
+//IsEmpty returns true when the two stores hold the same data
+func (d StoreDiff) IsEmpty() bool {
+	return d.ParticipantsEqual &&
+		len(d.MissingInA) == 0 &&
+		len(d.MissingInB) == 0 &&
+		len(d.Mismatched) == 0
+}
+
+//isComparedKey selects the keys CompareStores looks at: blocks, rounds and
+//events. Index keys and roots are derived data and are skipped.
+func isComparedKey(key string) bool {
+	if strings.HasPrefix(key, blockPrefix+"_") || strings.HasPrefix(key, roundPrefix+"_") {
+		return true
+	}
+	return strings.HasPrefix(key, "0x") &&
+		!strings.HasSuffix(key, "_"+rootSuffix) &&
+		!strings.Contains(key, "__event_")
+}
+
+//CompareStores pinpoints which blocks, rounds and events differ between two
+//stores. Blocks are compared by body hash, rounds by content and events by
+//presence. Both stores are only read; keys are streamed rather than loaded
+//into memory at once.
+func CompareStores(a, b *BadgerStore) (StoreDiff, error) {
+	aParticipants, _ := a.Participants()
+	bParticipants, _ := b.Participants()
+	diff := StoreDiff{ParticipantsEqual: participantsEqual(aParticipants, bParticipants)}
+
+	err := a.db.View(func(atxn *badger.Txn) error {
+		return b.db.View(func(btxn *badger.Txn) error {
+			//walk a: classify keys as missing-in-b or mismatched
+			it := atxn.NewIterator(badger.DefaultIteratorOptions)
+			for it.Rewind(); it.Valid(); it.Next() {
+				item := it.Item()
+				key := string(item.Key())
+				if !isComparedKey(key) {
+					continue
+				}
+				bItem, err := btxn.Get(item.Key())
+				if err != nil {
+					if isDBKeyNotFound(err) {
+						diff.MissingInB = append(diff.MissingInB, key)
+						continue
+					}
+					it.Close()
+					return err
+				}
+				//events are compared by presence only; their key is
+				//already their hash
+				if strings.HasPrefix(key, "0x") {
+					continue
+				}
+				av, err := item.Value()
+				if err != nil {
+					it.Close()
+					return err
+				}
+				bv, err := bItem.Value()
+				if err != nil {
+					it.Close()
+					return err
+				}
+				same, err := sameContent(key, av, bv)
+				if err != nil {
+					it.Close()
+					return err
+				}
+				if !same {
+					diff.Mismatched = append(diff.Mismatched, key)
+				}
+			}
+			it.Close()
+
+			//walk b: anything not in a is missing-in-a
+			opts := badger.DefaultIteratorOptions
+			opts.PrefetchValues = false
+			it = btxn.NewIterator(opts)
+			defer it.Close()
+			for it.Rewind(); it.Valid(); it.Next() {
+				key := string(it.Item().Key())
+				if !isComparedKey(key) {
+					continue
+				}
+				if _, err := atxn.Get(it.Item().Key()); err != nil {
+					if isDBKeyNotFound(err) {
+						diff.MissingInA = append(diff.MissingInA, key)
+						continue
+					}
+					return err
+				}
+			}
+			return nil
+		})
+	})
+
+	return diff, err
+}
+
+func participantsEqual(a, b map[string]int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for p, id := range a {
+		if other, ok := b[p]; !ok || other != id {
+			return false
+		}
+	}
+	return true
+}
+
+//sameContent compares two values of the same key. Blocks are compared by
+//body hash so differing signature sets do not count as divergence.
+func sameContent(key string, av, bv []byte) (bool, error) {
+	if strings.HasPrefix(key, blockPrefix+"_") {
+		aBlock, bBlock := new(types.Block), new(types.Block)
+		if err := aBlock.Unmarshal(av); err != nil {
+			return false, err
+		}
+		if err := bBlock.Unmarshal(bv); err != nil {
+			return false, err
+		}
+		aHash, err := aBlock.Body.Hash()
+		if err != nil {
+			return false, err
+		}
+		bHash, err := bBlock.Body.Hash()
+		if err != nil {
+			return false, err
+		}
+		return bytes.Equal(aHash, bHash), nil
+	}
+	return bytes.Equal(av, bv), nil
+}
@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/paradigm-network/paradigm/types"
+)
+
+func TestCompareStores(t *testing.T) {
+	a, aDir := initBadgerStore(t, 10)
+	defer removeBadgerStore(a, aDir)
+	b, bDir := initBadgerStore(t, 10)
+	defer removeBadgerStore(b, bDir)
+
+	//shared content
+	shared := newTestComet(0xAA, 0, 0)
+	for _, store := range []*BadgerStore{a, b} {
+		if err := store.SetComet(shared); err != nil {
+			t.Fatal(err)
+		}
+		round := types.NewRoundInfo()
+		round.AddEvent(shared.Hex(), true)
+		if err := store.SetRound(0, *round); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	diff, err := CompareStores(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !diff.IsEmpty() {
+		t.Fatalf("identical stores should have an empty diff, got %+v", diff)
+	}
+
+	//mutate: an event only in a, a block mismatch, a round only in b
+	onlyInA := newTestComet(0xBB, 0, 1)
+	if err := a.SetComet(onlyInA); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.SetBlock(types.NewBlock(0, 1, [][]byte{[]byte("tx-a")})); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SetBlock(types.NewBlock(0, 1, [][]byte{[]byte("tx-b")})); err != nil {
+		t.Fatal(err)
+	}
+	round := types.NewRoundInfo()
+	if err := b.SetRound(1, *round); err != nil {
+		t.Fatal(err)
+	}
+
+	diff, err = CompareStores(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.MissingInB) != 1 || diff.MissingInB[0] != onlyInA.Hex() {
+		t.Fatalf("expected %s missing in b, got %v", onlyInA.Hex(), diff.MissingInB)
+	}
+	if len(diff.Mismatched) != 1 || diff.Mismatched[0] != string(blockKey(0)) {
+		t.Fatalf("expected block 0 mismatched, got %v", diff.Mismatched)
+	}
+	if len(diff.MissingInA) != 1 || diff.MissingInA[0] != string(roundKey(1)) {
+		t.Fatalf("expected round 1 missing in a, got %v", diff.MissingInA)
+	}
+}
@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger"
+	"github.com/paradigm-network/paradigm/types"
+)
+
+//ArchiveTo compacts the store and then streams a badger backup into w,
+//so nightly archives do not carry reclaimable value-log garbage. This badger
+//has no Flatten, so compaction is a value-log GC pass; both phases are safe
+//on a live store. since and the returned version are badger backup versions,
+//letting callers chain incremental archives. Backup is single-threaded in
+//this badger, so there is no worker knob to expose.
+func (s *BadgerStore) ArchiveTo(w io.Writer, since uint64) (uint64, error) {
+	start := time.Now()
+	reclaimed, err := s.runGCCycle(0.5)
+	if err != nil {
+		return 0, err
+	}
+	s.logger.Info().
+		Int64("reclaimedBytes", reclaimed).
+		Dur("elapsed", time.Since(start)).
+		Msg("archive: gc phase done")
+
+	start = time.Now()
+	version, err := s.db.Backup(w, since)
+	if err != nil {
+		return 0, err
+	}
+	s.logger.Info().
+		Uint64("version", version).
+		Dur("elapsed", time.Since(start)).
+		Msg("archive: backup phase done")
+	return version, nil
+}
+
+//ExportParticipants writes the pubkey->id participant map as JSON, the
+//minimal piece of state needed to clone a network's membership into a new
+//store.
+func (s *BadgerStore) ExportParticipants(w io.Writer) error {
+	participants, err := s.Participants()
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(participants)
+}
+
+//ImportParticipants reads a participant map written by ExportParticipants,
+//persists it via dbSetParticipants, initializes a base root for every
+//imported participant that has none yet, and refreshes the live view. It is
+//how a new node's genesis is built from an existing store.
+func (s *BadgerStore) ImportParticipants(r io.Reader) error {
+	participants := map[string]int{}
+	if err := json.NewDecoder(r).Decode(&participants); err != nil {
+		return err
+	}
+	if err := s.dbSetParticipants(participants); err != nil {
+		return err
+	}
+	roots := make(map[string]types.Root)
+	for p := range participants {
+		root, err := s.dbGetRoot(p)
+		if err != nil {
+			if !isDBKeyNotFound(err) {
+				return err
+			}
+			root = types.NewBaseRoot()
+		}
+		roots[p] = root
+	}
+	if err := s.dbSetRoots(roots); err != nil {
+		return err
+	}
+	if err := s.dbSetGenesisRoots(roots); err != nil {
+		return err
+	}
+	return s.RefreshFromDisk()
+}
+
+//StoreDump is the shape of the JSON document written by ExportJSON
+type StoreDump struct {
+	Participants map[string]int             `json:"participants"`
+	Roots        map[string]json.RawMessage `json:"roots"`
+	Rounds       map[string]json.RawMessage `json:"rounds"`
+	Blocks       map[string]json.RawMessage `json:"blocks"`
+	Events       map[string]json.RawMessage `json:"events"`
+}
+
+func errMarker(err error) json.RawMessage {
+	return json.RawMessage(fmt.Sprintf("{\"error\":%q}", err.Error()))
+}
+
+//ExportJSON writes a human-readable JSON dump of the whole store:
+//participants, roots, rounds, blocks and events. Individual decode errors in
+//rounds and events do not abort the dump; the offending entry is replaced by
+//an error marker.
+//
+//WARNING: this walks the entire database and buffers one copy of it in
+//memory. It is meant for support dumps of small (test network) stores, not
+//for production databases.
+func (s *BadgerStore) ExportJSON(w io.Writer) error {
+	participants, _ := s.Participants()
+	dump := StoreDump{
+		Participants: participants,
+		Roots:        make(map[string]json.RawMessage),
+		Rounds:       make(map[string]json.RawMessage),
+		Blocks:       make(map[string]json.RawMessage),
+		Events:       make(map[string]json.RawMessage),
+	}
+
+	for p := range participants {
+		root, err := s.dbGetRoot(p)
+		if err != nil {
+			dump.Roots[p] = errMarker(err)
+			continue
+		}
+		raw, err := root.Marshal()
+		if err != nil {
+			dump.Roots[p] = errMarker(err)
+			continue
+		}
+		dump.Roots[p] = json.RawMessage(raw)
+	}
+
+	err := s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			key := string(item.Key())
+			switch {
+			case strings.HasPrefix(key, roundPrefix+"_"):
+				index := key[len(roundPrefix)+1:]
+				v, err := item.Value()
+				if err != nil {
+					dump.Rounds[index] = errMarker(err)
+					continue
+				}
+				round := new(types.RoundInfo)
+				if err := round.Unmarshal(v); err != nil {
+					dump.Rounds[index] = errMarker(err)
+					continue
+				}
+				dump.Rounds[index] = append(json.RawMessage{}, v...)
+			case strings.HasPrefix(key, "0x") &&
+				!strings.HasSuffix(key, "_"+rootSuffix) &&
+				!strings.Contains(key, "__event_"):
+				v, err := item.Value()
+				if err != nil {
+					dump.Events[key] = errMarker(err)
+					continue
+				}
+				comet := new(types.Comet)
+				if err := comet.Unmarshal(v); err != nil {
+					dump.Events[key] = errMarker(err)
+					continue
+				}
+				dump.Events[key] = append(json.RawMessage{}, v...)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	//blocks are streamed one at a time through ForEachBlock; a corrupt
+	//block aborts the dump since the walk cannot skip past it
+	err = s.ForEachBlock(func(block types.Block) error {
+		raw, err := block.Marshal()
+		if err != nil {
+			dump.Blocks[fmt.Sprintf("%09d", block.Index())] = errMarker(err)
+			return nil
+		}
+		dump.Blocks[fmt.Sprintf("%09d", block.Index())] = json.RawMessage(raw)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	return enc.Encode(dump)
+}
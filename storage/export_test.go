@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	"github.com/paradigm-network/paradigm/types"
+)
+
+func TestExportJSON(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	comet := newTestComet(0xAA, 0, 0)
+	if err := store.SetComet(comet); err != nil {
+		t.Fatal(err)
+	}
+
+	round := types.NewRoundInfo()
+	round.AddEvent(comet.Hex(), true)
+	if err := store.SetRound(0, *round); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.SetBlock(types.NewBlock(0, 1, [][]byte{[]byte("tx")})); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := store.ExportJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	dump := new(StoreDump)
+	if err := json.Unmarshal(buf.Bytes(), dump); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(dump.Participants) != 3 {
+		t.Fatalf("expected 3 participants, got %d", len(dump.Participants))
+	}
+	if len(dump.Roots) != 3 {
+		t.Fatalf("expected 3 roots, got %d", len(dump.Roots))
+	}
+	if _, ok := dump.Rounds["000000000"]; !ok {
+		t.Fatal("round 0 missing from dump")
+	}
+	if _, ok := dump.Blocks["000000000"]; !ok {
+		t.Fatal("block 0 missing from dump")
+	}
+	raw, ok := dump.Events[comet.Hex()]
+	if !ok {
+		t.Fatal("event missing from dump")
+	}
+
+	//the dumped event decodes back to the original
+	decoded := new(types.Comet)
+	if err := decoded.Unmarshal(raw); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Hex() != comet.Hex() {
+		t.Fatal("dumped event does not round-trip")
+	}
+}
+
+func TestArchiveTo(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	comets := populateEvents(t, store, 10)
+	if err := store.SetBlock(types.NewBlock(0, 1, [][]byte{[]byte("tx")})); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	version, err := store.ArchiveTo(&buf, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version == 0 {
+		t.Fatal("expected a non-zero backup version")
+	}
+	if buf.Len() == 0 {
+		t.Fatal("expected a non-empty archive")
+	}
+
+	//the archive restores into a fresh store
+	restored, restoredDir := initBadgerStore(t, 10)
+	defer removeBadgerStore(restored, restoredDir)
+	if err := restored.db.Load(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	for _, comet := range comets {
+		if _, err := restored.dbGetEvent(comet.Hex()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := restored.dbGetBlock(0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParticipantsRoundTrip(t *testing.T) {
+	source, sourceDir := initBadgerStore(t, 10)
+	defer removeBadgerStore(source, sourceDir)
+
+	//a brand new store with no members yet
+	dir, err := ioutil.TempDir("", "badger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, err := NewBadgerStore(map[string]int{}, 10, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer removeBadgerStore(target, dir)
+
+	var buf bytes.Buffer
+	if err := source.ExportParticipants(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := target.ImportParticipants(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	expected, err := source.Participants()
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported, err := target.Participants()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(imported) != len(expected) {
+		t.Fatalf("expected %d participants, got %d", len(expected), len(imported))
+	}
+	for p, id := range expected {
+		if imported[p] != id {
+			t.Fatalf("expected id %d for %s, got %d", id, p, imported[p])
+		}
+		//every imported participant starts from a base root
+		root, err := target.GetRoot(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if root.Index != -1 {
+			t.Fatalf("expected a base root for %s, got index %d", p, root.Index)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package storage
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+
+	"github.com/dgraph-io/badger"
+)
+
+//kvTxn is the view of a transaction the store's generic code works against
+type kvTxn interface {
+	Get(key []byte) ([]byte, error)
+	Set(key, value []byte) error
+	Delete(key []byte) error
+}
+
+//kvEngine is the key-value surface behind the store's flat metadata
+//namespace: the point keys (codec, generation, watermarks, last-applied),
+//the consensus-order list, participant weights and the application Get/Put
+//API, plus simple prefix scans such as the participant map. It is NOT a
+//full engine abstraction: the event, round and block paths still bind to
+//badger directly for key-only iteration, TTL writes, long-lived read
+//transactions, backup and value-log GC, so a BadgerStore cannot yet run
+//entirely on an alternative engine. Missing keys are reported with
+//badger.ErrKeyNotFound so the existing error mapping keeps working
+//regardless of the implementation.
+type kvEngine interface {
+	Get(key []byte) ([]byte, error)
+	Set(key, value []byte) error
+	Delete(key []byte) error
+	View(fn func(kvTxn) error) error
+	Update(fn func(kvTxn) error) error
+	//Iterate visits the keys under prefix in lexical order, reversed on
+	//demand, stopping at the first error from fn
+	Iterate(prefix []byte, reverse bool, fn func(key, value []byte) error) error
+	Close() error
+}
+
+//------------------------------------------------------------------------------
+//badger implementation
+
+type badgerKV struct {
+	db *badger.DB
+}
+
+type badgerKVTxn struct {
+	txn *badger.Txn
+}
+
+func (t badgerKVTxn) Get(key []byte) ([]byte, error) {
+	item, err := t.txn.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return item.ValueCopy(nil)
+}
+
+func (t badgerKVTxn) Set(key, value []byte) error {
+	return t.txn.Set(key, value)
+}
+
+func (t badgerKVTxn) Delete(key []byte) error {
+	return t.txn.Delete(key)
+}
+
+func (e *badgerKV) Get(key []byte) ([]byte, error) {
+	var value []byte
+	err := e.db.View(func(txn *badger.Txn) error {
+		var err error
+		value, err = badgerKVTxn{txn}.Get(key)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func (e *badgerKV) Set(key, value []byte) error {
+	tx := e.db.NewTransaction(true)
+	defer tx.Discard()
+	if err := tx.Set(key, value); err != nil {
+		return err
+	}
+	return tx.Commit(nil)
+}
+
+func (e *badgerKV) Delete(key []byte) error {
+	tx := e.db.NewTransaction(true)
+	defer tx.Discard()
+	if err := tx.Delete(key); err != nil {
+		return err
+	}
+	return tx.Commit(nil)
+}
+
+func (e *badgerKV) View(fn func(kvTxn) error) error {
+	return e.db.View(func(txn *badger.Txn) error {
+		return fn(badgerKVTxn{txn})
+	})
+}
+
+func (e *badgerKV) Update(fn func(kvTxn) error) error {
+	tx := e.db.NewTransaction(true)
+	defer tx.Discard()
+	if err := fn(badgerKVTxn{tx}); err != nil {
+		return err
+	}
+	return tx.Commit(nil)
+}
+
+func (e *badgerKV) Iterate(prefix []byte, reverse bool, fn func(key, value []byte) error) error {
+	return e.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Reverse = reverse
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		seek := prefix
+		if reverse {
+			//seek past the last key under the prefix and walk backwards
+			seek = append(append([]byte{}, prefix...), 0xFF)
+		}
+		for it.Seek(seek); it.ValidForPrefix(prefix); it.Next() {
+			v, err := it.Item().Value()
+			if err != nil {
+				return err
+			}
+			if err := fn(it.Item().KeyCopy(nil), v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (e *badgerKV) Close() error {
+	return e.db.Close()
+}
+
+//------------------------------------------------------------------------------
+//in-memory implementation. It backs the engine-contract test and is a
+//template for future engines; it cannot back a whole BadgerStore because of
+//the direct badger paths listed on kvEngine.
+
+type memKV struct {
+	sync.RWMutex
+	data map[string][]byte
+}
+
+func newMemKV() *memKV {
+	return &memKV{data: make(map[string][]byte)}
+}
+
+//memKVTxn stages writes and applies them on commit, so a failed Update
+//leaves the engine untouched
+type memKVTxn struct {
+	e       *memKV
+	writes  map[string][]byte
+	deletes map[string]bool
+}
+
+func (t *memKVTxn) Get(key []byte) ([]byte, error) {
+	k := string(key)
+	if t.deletes[k] {
+		return nil, badger.ErrKeyNotFound
+	}
+	if v, ok := t.writes[k]; ok {
+		return append([]byte{}, v...), nil
+	}
+	v, ok := t.e.data[k]
+	if !ok {
+		return nil, badger.ErrKeyNotFound
+	}
+	return append([]byte{}, v...), nil
+}
+
+func (t *memKVTxn) Set(key, value []byte) error {
+	k := string(key)
+	delete(t.deletes, k)
+	t.writes[k] = append([]byte{}, value...)
+	return nil
+}
+
+func (t *memKVTxn) Delete(key []byte) error {
+	k := string(key)
+	delete(t.writes, k)
+	t.deletes[k] = true
+	return nil
+}
+
+func (e *memKV) Get(key []byte) ([]byte, error) {
+	e.RLock()
+	defer e.RUnlock()
+	v, ok := e.data[string(key)]
+	if !ok {
+		return nil, badger.ErrKeyNotFound
+	}
+	return append([]byte{}, v...), nil
+}
+
+func (e *memKV) Set(key, value []byte) error {
+	e.Lock()
+	defer e.Unlock()
+	e.data[string(key)] = append([]byte{}, value...)
+	return nil
+}
+
+func (e *memKV) Delete(key []byte) error {
+	e.Lock()
+	defer e.Unlock()
+	delete(e.data, string(key))
+	return nil
+}
+
+func (e *memKV) View(fn func(kvTxn) error) error {
+	e.RLock()
+	defer e.RUnlock()
+	return fn(&memKVTxn{e: e, writes: make(map[string][]byte), deletes: make(map[string]bool)})
+}
+
+func (e *memKV) Update(fn func(kvTxn) error) error {
+	txn := &memKVTxn{e: e, writes: make(map[string][]byte), deletes: make(map[string]bool)}
+	e.Lock()
+	defer e.Unlock()
+	if err := fn(txn); err != nil {
+		return err
+	}
+	for k, v := range txn.writes {
+		e.data[k] = v
+	}
+	for k := range txn.deletes {
+		delete(e.data, k)
+	}
+	return nil
+}
+
+func (e *memKV) Iterate(prefix []byte, reverse bool, fn func(key, value []byte) error) error {
+	e.RLock()
+	keys := make([]string, 0, len(e.data))
+	for k := range e.data {
+		if bytes.HasPrefix([]byte(k), prefix) {
+			keys = append(keys, k)
+		}
+	}
+	e.RUnlock()
+
+	sort.Strings(keys)
+	if reverse {
+		for i, j := 0, len(keys)-1; i < j; i, j = i+1, j-1 {
+			keys[i], keys[j] = keys[j], keys[i]
+		}
+	}
+	for _, k := range keys {
+		v, err := e.Get([]byte(k))
+		if err != nil {
+			if isDBKeyNotFound(err) {
+				continue //deleted while iterating
+			}
+			return err
+		}
+		if err := fn([]byte(k), v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *memKV) Close() error {
+	return nil
+}
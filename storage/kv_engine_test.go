@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+)
+
+//runKVEngineSuite is the engine contract: every kvEngine implementation must
+//pass it so the metadata paths routed through the interface behave the same
+//regardless of the implementation. The event/round/block paths are not
+//covered - they still bind to badger directly, see the kvEngine doc.
+func runKVEngineSuite(t *testing.T, kv kvEngine) {
+	//set / get
+	if err := kv.Set([]byte("a_1"), []byte("one")); err != nil {
+		t.Fatal(err)
+	}
+	v, err := kv.Get([]byte("a_1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(v) != "one" {
+		t.Fatalf("expected one, got %s", v)
+	}
+
+	//missing keys map through the shared error check
+	if _, err := kv.Get([]byte("missing")); err == nil || !isDBKeyNotFound(err) {
+		t.Fatalf("expected a key-not-found error, got %v", err)
+	}
+
+	//delete
+	if err := kv.Delete([]byte("a_1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kv.Get([]byte("a_1")); err == nil {
+		t.Fatal("deleted key should be gone")
+	}
+
+	//update commits all writes together
+	err = kv.Update(func(txn kvTxn) error {
+		for i := 0; i < 3; i++ {
+			if err := txn.Set([]byte(fmt.Sprintf("b_%d", i)), []byte{byte(i)}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//a failed update leaves nothing behind
+	boom := fmt.Errorf("boom")
+	err = kv.Update(func(txn kvTxn) error {
+		if err := txn.Set([]byte("b_9"), []byte("nope")); err != nil {
+			return err
+		}
+		return boom
+	})
+	if err != boom {
+		t.Fatalf("expected boom, got %v", err)
+	}
+	if _, err := kv.Get([]byte("b_9")); err == nil {
+		t.Fatal("aborted write should not be visible")
+	}
+
+	//view sees committed data
+	err = kv.View(func(txn kvTxn) error {
+		v, err := txn.Get([]byte("b_1"))
+		if err != nil {
+			return err
+		}
+		if len(v) != 1 || v[0] != 1 {
+			return fmt.Errorf("unexpected value %v", v)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//prefix iteration in both directions
+	forward := []string{}
+	err = kv.Iterate([]byte("b_"), false, func(key, value []byte) error {
+		forward = append(forward, string(key))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(forward) != 3 || forward[0] != "b_0" || forward[2] != "b_2" {
+		t.Fatalf("unexpected forward order: %v", forward)
+	}
+
+	backward := []string{}
+	err = kv.Iterate([]byte("b_"), true, func(key, value []byte) error {
+		backward = append(backward, string(key))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backward) != 3 || backward[0] != "b_2" || backward[2] != "b_0" {
+		t.Fatalf("unexpected backward order: %v", backward)
+	}
+
+	//fn errors stop the iteration and propagate
+	stop := fmt.Errorf("stop")
+	if err := kv.Iterate([]byte("b_"), false, func(key, value []byte) error {
+		return stop
+	}); err != stop {
+		t.Fatalf("expected stop, got %v", err)
+	}
+}
+
+func TestBadgerKVEngine(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+	runKVEngineSuite(t, store.kv)
+}
+
+func TestMemKVEngine(t *testing.T) {
+	kv := newMemKV()
+	defer kv.Close()
+	runKVEngineSuite(t, kv)
+}
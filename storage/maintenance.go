@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/dgraph-io/badger"
+)
+
+//MaintenancePolicy holds the thresholds RunMaintenance checks to decide
+//which maintenance actions to perform. The zero value performs nothing.
+type MaintenancePolicy struct {
+	//GCThresholdBytes runs a value-log GC cycle when the value log is at
+	//least this large. 0 disables the GC step.
+	GCThresholdBytes int64
+
+	//GCDiscardRatio is the discard ratio handed to RunValueLogGC. Must be
+	//in (0,1); 0 means the default of 0.5.
+	GCDiscardRatio float64
+
+	//MaxRounds prunes the oldest stored rounds once more than this many are
+	//on disk. 0 disables the pruning step.
+	MaxRounds int
+
+	//KeepRounds is how many of the most recent rounds survive a prune.
+	//0, or anything above MaxRounds, means MaxRounds.
+	KeepRounds int
+}
+
+//MaintenanceReport describes what a RunMaintenance call did.
+type MaintenanceReport struct {
+	GCRan          bool
+	ReclaimedBytes int64
+	PruneRan       bool
+	PrunedRounds   int
+	Elapsed        time.Duration
+}
+
+//RunMaintenance is the single operator entry point for store upkeep: it
+//checks the value-log size and the stored round count against the policy
+//and runs value-log GC and round pruning as warranted, returning a report
+//of what ran and what it reclaimed. This badger has no Flatten, so LSM
+//compaction is left to the engine's own levelling. Calls are serialized
+//internally, so scheduling it on a ticker is safe even when a previous run
+//is still in flight.
+func (s *BadgerStore) RunMaintenance(policy MaintenancePolicy) (MaintenanceReport, error) {
+	s.maintenanceLock.Lock()
+	defer s.maintenanceLock.Unlock()
+	start := time.Now()
+	report := MaintenanceReport{}
+
+	if policy.GCThresholdBytes > 0 {
+		vlog, err := s.valueLogSize()
+		if err != nil {
+			report.Elapsed = time.Since(start)
+			return report, err
+		}
+		if vlog >= policy.GCThresholdBytes {
+			ratio := policy.GCDiscardRatio
+			if ratio <= 0 || ratio >= 1 {
+				ratio = 0.5
+			}
+			reclaimed, err := s.runGCCycle(ratio)
+			if err != nil {
+				report.Elapsed = time.Since(start)
+				return report, err
+			}
+			report.GCRan = true
+			report.ReclaimedBytes = reclaimed
+		}
+	}
+
+	if policy.MaxRounds > 0 {
+		keep := policy.KeepRounds
+		if keep <= 0 || keep > policy.MaxRounds {
+			keep = policy.MaxRounds
+		}
+		pruned, ran, err := s.pruneRounds(policy.MaxRounds, keep)
+		if err != nil {
+			report.Elapsed = time.Since(start)
+			return report, err
+		}
+		report.PruneRan = ran
+		report.PrunedRounds = pruned
+	}
+
+	report.Elapsed = time.Since(start)
+	return report, nil
+}
+
+//valueLogSize sums the on-disk size of the value-log files directly.
+//db.Size() only refreshes its numbers on a one-minute ticker in this
+//badger, which is far too coarse for a threshold check.
+func (s *BadgerStore) valueLogSize() (int64, error) {
+	files, err := filepath.Glob(filepath.Join(s.path, "*.vlog"))
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			return 0, err
+		}
+		total += info.Size()
+	}
+	return total, nil
+}
+
+//pruneRounds deletes the oldest stored rounds once more than max are on
+//disk, keeping the keep most recent. Pruned rounds are also evicted from
+//the cache so stale copies do not outlive their db entries.
+func (s *BadgerStore) pruneRounds(max, keep int) (int, bool, error) {
+	indexes := []int{}
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		prefix := []byte(roundPrefix + "_")
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			index, err := strconv.Atoi(string(it.Item().Key())[len(prefix):])
+			if err != nil {
+				continue
+			}
+			indexes = append(indexes, index)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, false, err
+	}
+	if len(indexes) <= max {
+		return 0, false, nil
+	}
+	sort.Ints(indexes)
+	victims := indexes[:len(indexes)-keep]
+
+	s.acquireWrite()
+	defer s.releaseWrite()
+	tx := s.db.NewTransaction(true)
+	defer tx.Discard()
+	for _, r := range victims {
+		if err := tx.Delete(roundKey(r)); err != nil {
+			return 0, false, err
+		}
+	}
+	if err := tx.Commit(nil); err != nil {
+		return 0, false, err
+	}
+	for _, r := range victims {
+		s.inmemStore.roundCache.Remove(r)
+	}
+	return len(victims), true, nil
+}
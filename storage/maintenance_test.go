@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/paradigm-network/paradigm/errors"
+	"github.com/paradigm-network/paradigm/types"
+)
+
+func TestRunMaintenance(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	populateEvents(t, store, 20)
+	for r := 0; r < 12; r++ {
+		round := types.NewRoundInfo()
+		round.AddEvent("0xWITNESS", true)
+		if err := store.SetRound(r, *round); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	//a zero policy performs nothing
+	report, err := store.RunMaintenance(MaintenancePolicy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.GCRan || report.PruneRan {
+		t.Fatalf("expected a zero policy to do nothing, got %+v", report)
+	}
+
+	report, err = store.RunMaintenance(MaintenancePolicy{
+		GCThresholdBytes: 1,
+		MaxRounds:        10,
+		KeepRounds:       4,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.GCRan {
+		t.Fatal("expected the gc step to run")
+	}
+	if report.ReclaimedBytes < 0 {
+		t.Fatalf("reclaimed bytes should never be negative, got %d", report.ReclaimedBytes)
+	}
+	if !report.PruneRan || report.PrunedRounds != 8 {
+		t.Fatalf("expected 8 pruned rounds, got %+v", report)
+	}
+
+	//the oldest rounds are gone from disk and cache, the newest survive
+	store.FlushCache()
+	if _, err := store.GetRound(0); !errors.Is(err, errors.KeyNotFound) {
+		t.Fatalf("expected round 0 to be pruned, got %v", err)
+	}
+	if _, err := store.GetRound(7); !errors.Is(err, errors.KeyNotFound) {
+		t.Fatalf("expected round 7 to be pruned, got %v", err)
+	}
+	if _, err := store.GetRound(8); err != nil {
+		t.Fatalf("expected round 8 to survive, got %v", err)
+	}
+	if _, err := store.GetRound(11); err != nil {
+		t.Fatalf("expected round 11 to survive, got %v", err)
+	}
+
+	//with the count back under the threshold, pruning is a no-op again
+	report, err = store.RunMaintenance(MaintenancePolicy{MaxRounds: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.PruneRan {
+		t.Fatalf("expected no pruning under the threshold, got %+v", report)
+	}
+}
@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"github.com/paradigm-network/paradigm/types"
+)
+
+//InmemSnapshot is an opaque copy of an InmemStore's state, produced by
+//Snapshot and consumed by NewInmemStoreFromSnapshot. It lets tests build an
+//expensive store once and stamp out fresh, independent instances instead of
+//replaying every event.
+type InmemSnapshot struct {
+	cacheSize    int
+	participants map[string]int
+	//event/round/block keys in cache insertion order, so a restore
+	//reproduces the same eviction behaviour
+	eventKeys []string
+	events    map[string]types.Comet
+	roundKeys []int
+	rounds    map[int]types.RoundInfo
+	blockKeys []int
+	blocks    map[int]types.Block
+	roots     map[string]types.Root
+	//per-participant event hashes, ascending from participantFirst
+	participantEvents map[string][]string
+	participantFirst  map[string]int
+	consensus         []string
+	consensusFirst    int
+	totConsensus      int
+	lastRound         int
+}
+
+//Snapshot deep-copies the store's internal state. The store must not be
+//written to concurrently.
+func (s *InmemStore) Snapshot() InmemSnapshot {
+	snap := InmemSnapshot{
+		cacheSize:         s.cacheSize,
+		participants:      make(map[string]int, len(s.participants)),
+		events:            make(map[string]types.Comet),
+		rounds:            make(map[int]types.RoundInfo),
+		blocks:            make(map[int]types.Block),
+		roots:             make(map[string]types.Root, len(s.roots)),
+		participantEvents: make(map[string][]string),
+		participantFirst:  make(map[string]int),
+		totConsensus:      s.totConsensusEvents,
+		lastRound:         s.lastRound,
+	}
+	for p, id := range s.participants {
+		snap.participants[p] = id
+	}
+	for p, root := range s.roots {
+		snap.roots[p] = root
+	}
+
+	for _, k := range s.eventCache.Keys() {
+		key := k.(string)
+		if v, ok := s.eventCache.Peek(key); ok {
+			snap.eventKeys = append(snap.eventKeys, key)
+			snap.events[key] = v.(types.Comet)
+		}
+	}
+	for _, k := range s.roundCache.Keys() {
+		key := k.(int)
+		if v, ok := s.roundCache.Peek(key); ok {
+			snap.roundKeys = append(snap.roundKeys, key)
+			snap.rounds[key] = v.(types.RoundInfo)
+		}
+	}
+	for _, k := range s.blockCache.Keys() {
+		key := k.(int)
+		if v, ok := s.blockCache.Peek(key); ok {
+			snap.blockKeys = append(snap.blockKeys, key)
+			snap.blocks[key] = v.(types.Block)
+		}
+	}
+
+	//walk each participant's window backwards until the rolling index says
+	//the history is gone, then record the hashes in ascending order
+	for p := range s.participants {
+		last, err := s.participantEventsCache.GetLast(p)
+		if err != nil || last == "" {
+			continue
+		}
+		known := s.participantEventsCache.Known()
+		lastIndex := known[s.participants[p]]
+		hashes := []string{}
+		first := lastIndex
+		for i := lastIndex; i >= 0; i-- {
+			hash, err := s.participantEventsCache.GetItem(p, i)
+			if err != nil {
+				break
+			}
+			hashes = append([]string{hash}, hashes...)
+			first = i
+		}
+		snap.participantEvents[p] = hashes
+		snap.participantFirst[p] = first
+	}
+
+	window, lastIndex := s.consensusCache.GetLastWindow()
+	snap.consensusFirst = lastIndex - len(window) + 1
+	for _, item := range window {
+		snap.consensus = append(snap.consensus, item.(string))
+	}
+
+	return snap
+}
+
+//NewInmemStoreFromSnapshot builds a fresh InmemStore holding the same state
+//as the snapshotted one. The two stores share nothing, so mutating one never
+//leaks into the other.
+func NewInmemStoreFromSnapshot(snap InmemSnapshot) (*InmemStore, error) {
+	participants := make(map[string]int, len(snap.participants))
+	for p, id := range snap.participants {
+		participants[p] = id
+	}
+	store := NewInmemStore(participants, snap.cacheSize)
+
+	roots := make(map[string]types.Root, len(snap.roots))
+	for p, root := range snap.roots {
+		roots[p] = root
+	}
+	store.roots = roots
+
+	for p, hashes := range snap.participantEvents {
+		index := snap.participantFirst[p]
+		for _, hash := range hashes {
+			if err := store.participantEventsCache.Set(p, hash, index); err != nil {
+				return nil, err
+			}
+			index++
+		}
+	}
+
+	for _, key := range snap.eventKeys {
+		store.eventCache.Add(key, snap.events[key])
+	}
+	for _, key := range snap.roundKeys {
+		store.roundCache.Add(key, snap.rounds[key])
+	}
+	for _, key := range snap.blockKeys {
+		store.blockCache.Add(key, snap.blocks[key])
+	}
+
+	for i, item := range snap.consensus {
+		if err := store.consensusCache.Set(item, snap.consensusFirst+i); err != nil {
+			return nil, err
+		}
+	}
+	store.totConsensusEvents = snap.totConsensus
+	store.lastRound = snap.lastRound
+
+	return store, nil
+}
@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/paradigm-network/paradigm/types"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	participants := map[string]int{
+		"0xAA": 0,
+		"0xBB": 1,
+	}
+	original := NewInmemStore(participants, 100)
+
+	comets := []types.Comet{}
+	for i, e := range []struct {
+		creator byte
+		index   int
+	}{
+		{0xAA, 0}, {0xBB, 0}, {0xAA, 1}, {0xBB, 1}, {0xAA, 2},
+	} {
+		comet := newTestComet(e.creator, e.index, i)
+		comets = append(comets, comet)
+		if err := original.SetComet(comet); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	round := types.NewRoundInfo()
+	round.AddEvent(comets[0].Hex(), true)
+	if err := original.SetRound(0, *round); err != nil {
+		t.Fatal(err)
+	}
+	if err := original.SetBlock(types.NewBlock(0, 1, [][]byte{[]byte("tx")})); err != nil {
+		t.Fatal(err)
+	}
+	for _, comet := range comets[:3] {
+		if err := original.AddConsensusEvent(comet.Hex()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	restored, err := NewInmemStoreFromSnapshot(original.Snapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//events, per-participant lists and known map match
+	for _, comet := range comets {
+		got, err := restored.GetComet(comet.Hex())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Hex() != comet.Hex() {
+			t.Fatalf("restored event mismatch for %s", comet.Hex())
+		}
+	}
+	for p := range participants {
+		want, err := original.ParticipantEvents(p, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := restored.ParticipantEvents(p, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("participant %s: expected %d events, got %d", p, len(want), len(got))
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("participant %s: events differ at position %d", p, i)
+			}
+		}
+	}
+	origKnown := original.KnownEvents()
+	for pid, index := range restored.KnownEvents() {
+		if origKnown[pid] != index {
+			t.Fatalf("known[%d] should be %d, not %d", pid, origKnown[pid], index)
+		}
+	}
+
+	//rounds, blocks, roots and the consensus list match
+	if _, err := restored.GetRound(0); err != nil {
+		t.Fatal(err)
+	}
+	if restored.LastRound() != original.LastRound() {
+		t.Fatalf("expected last round %d, got %d", original.LastRound(), restored.LastRound())
+	}
+	if _, err := restored.GetBlock(0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := restored.GetRoot("0xAA"); err != nil {
+		t.Fatal(err)
+	}
+	if c := restored.ConsensusEventsCount(); c != original.ConsensusEventsCount() {
+		t.Fatalf("expected %d consensus events, got %d", original.ConsensusEventsCount(), c)
+	}
+	wantConsensus := original.ConsensusEvents()
+	gotConsensus := restored.ConsensusEvents()
+	if len(gotConsensus) != len(wantConsensus) {
+		t.Fatalf("expected %d consensus hashes, got %d", len(wantConsensus), len(gotConsensus))
+	}
+	for i := range wantConsensus {
+		if gotConsensus[i] != wantConsensus[i] {
+			t.Fatalf("consensus lists differ at position %d", i)
+		}
+	}
+
+	//the restored store is independent of the original
+	extra := newTestComet(0xBB, 2, 5)
+	if err := restored.SetComet(extra); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := original.GetComet(extra.Hex()); err == nil {
+		t.Fatal("writing to the restored store should not leak into the original")
+	}
+}
@@ -19,6 +19,10 @@ type InmemStore struct {
 	participantEventsCache *ParticipantEventsCache
 	roots                  map[string]types.Root
 	lastRound              int
+	//pinned entries are consulted before the LRU caches and are immune to
+	//eviction; see the PinKeys store option
+	pinnedRounds map[int]types.RoundInfo
+	pinnedBlocks map[int]types.Block
 }
 
 func NewInmemStore(participants map[string]int, cacheSize int) *InmemStore {
@@ -72,6 +76,25 @@ func (s *InmemStore) SetComet(event types.Comet) error {
 	return nil
 }
 
+//SetComets inserts a batch of events in one pass, keeping the per-participant
+//lists and the event cache consistent with repeated SetComet calls
+func (s *InmemStore) SetComets(events []types.Comet) error {
+	for _, event := range events {
+		key := event.Hex()
+		_, err := s.GetComet(key)
+		if err != nil && !errors.Is(err, errors.KeyNotFound) {
+			return err
+		}
+		if errors.Is(err, errors.KeyNotFound) {
+			if err := s.addParticpantEvent(event.Creator(), key, event.Index()); err != nil {
+				return err
+			}
+		}
+		s.eventCache.Add(key, event)
+	}
+	return nil
+}
+
 func (s *InmemStore) addParticpantEvent(participant string, hash string, index int) error {
 	return s.participantEventsCache.Set(participant, hash, index)
 }
@@ -126,7 +149,36 @@ func (s *InmemStore) AddConsensusEvent(key string) error {
 	return nil
 }
 
+//TruncateConsensusEvents drops consensus events at and after index. The
+//rolling window cannot be rewound in place, so it is rebuilt from the
+//surviving entries.
+func (s *InmemStore) TruncateConsensusEvents(index int) error {
+	if index < 0 {
+		index = 0
+	}
+	if index >= s.totConsensusEvents {
+		return nil
+	}
+	lastWindow, lastIndex := s.consensusCache.GetLastWindow()
+	oldest := lastIndex - len(lastWindow) + 1
+	rebuilt := common.NewRollingIndex(s.cacheSize)
+	for i, item := range lastWindow {
+		if oldest+i >= index {
+			break
+		}
+		if err := rebuilt.Set(item, oldest+i); err != nil {
+			return err
+		}
+	}
+	s.consensusCache = rebuilt
+	s.totConsensusEvents = index
+	return nil
+}
+
 func (s *InmemStore) GetRound(r int) (types.RoundInfo, error) {
+	if round, ok := s.pinnedRounds[r]; ok {
+		return round, nil
+	}
 	res, ok := s.roundCache.Get(r)
 	if !ok {
 		return *types.NewRoundInfo(), errors.NewStoreErr(errors.KeyNotFound, strconv.Itoa(r))
@@ -135,6 +187,9 @@ func (s *InmemStore) GetRound(r int) (types.RoundInfo, error) {
 }
 
 func (s *InmemStore) SetRound(r int, round types.RoundInfo) error {
+	if _, ok := s.pinnedRounds[r]; ok {
+		s.pinnedRounds[r] = round
+	}
 	s.roundCache.Add(r, round)
 	if r > s.lastRound {
 		s.lastRound = r
@@ -142,6 +197,18 @@ func (s *InmemStore) SetRound(r int, round types.RoundInfo) error {
 	return nil
 }
 
+//PinRound keeps a round resident regardless of cache eviction. Later
+//SetRound calls for the same index update the pinned copy.
+func (s *InmemStore) PinRound(r int, round types.RoundInfo) {
+	if s.pinnedRounds == nil {
+		s.pinnedRounds = make(map[int]types.RoundInfo)
+	}
+	s.pinnedRounds[r] = round
+	if r > s.lastRound {
+		s.lastRound = r
+	}
+}
+
 func (s *InmemStore) LastRound() int {
 	return s.lastRound
 }
@@ -171,6 +238,9 @@ func (s *InmemStore) GetRoot(participant string) (types.Root, error) {
 }
 
 func (s *InmemStore) GetBlock(index int) (types.Block, error) {
+	if block, ok := s.pinnedBlocks[index]; ok {
+		return block, nil
+	}
 	res, ok := s.blockCache.Get(index)
 	if !ok {
 		return types.Block{}, errors.NewStoreErr(errors.KeyNotFound, strconv.Itoa(index))
@@ -183,15 +253,40 @@ func (s *InmemStore) SetBlock(block types.Block) error {
 	if err != nil && !errors.Is(err, errors.KeyNotFound) {
 		return err
 	}
+	if _, ok := s.pinnedBlocks[block.Index()]; ok {
+		s.pinnedBlocks[block.Index()] = block
+	}
 	s.blockCache.Add(block.Index(), block)
 	return nil
 }
 
+//PinBlock keeps a block resident regardless of cache eviction. Later
+//SetBlock calls for the same index update the pinned copy.
+func (s *InmemStore) PinBlock(block types.Block) {
+	if s.pinnedBlocks == nil {
+		s.pinnedBlocks = make(map[int]types.Block)
+	}
+	s.pinnedBlocks[block.Index()] = block
+}
+
+//FlushCache evicts all cached comets, rounds and blocks while keeping the
+//roots, participants and index watermarks. On its own an InmemStore loses
+//that data for good; the point is the BadgerStore wrapper, where a flush
+//forces subsequent reads down the db fallback path.
+func (s *InmemStore) FlushCache() {
+	s.eventCache = common.NewLRU(s.cacheSize, nil)
+	s.roundCache = common.NewLRU(s.cacheSize, nil)
+	s.blockCache = common.NewLRU(s.cacheSize, nil)
+}
+
 func (s *InmemStore) Reset(roots map[string]types.Root) error {
 	s.roots = roots
 	s.eventCache = common.NewLRU(s.cacheSize, nil)
 	s.roundCache = common.NewLRU(s.cacheSize, nil)
 	s.consensusCache = common.NewRollingIndex(s.cacheSize)
+	//pins reference pre-reset state; PinKeys stores re-pin after a refresh
+	s.pinnedRounds = nil
+	s.pinnedBlocks = nil
 	err := s.participantEventsCache.Reset()
 	s.lastRound = -1
 	return err
@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/paradigm-network/paradigm/types"
+)
+
+func TestSetCometsMatchesSequential(t *testing.T) {
+	participants := map[string]int{
+		"0xAA": 0,
+		"0xBB": 1,
+	}
+
+	sequential := NewInmemStore(participants, 100)
+	batched := NewInmemStore(participants, 100)
+
+	events := []struct {
+		creator byte
+		index   int
+	}{
+		{0xAA, 0}, {0xBB, 0}, {0xAA, 1}, {0xBB, 1}, {0xAA, 2},
+	}
+
+	comets := make([]types.Comet, 0)
+	for i, e := range events {
+		comet := newTestComet(e.creator, e.index, i)
+		comets = append(comets, comet)
+		if err := sequential.SetComet(comet); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := batched.SetComets(comets); err != nil {
+		t.Fatal(err)
+	}
+
+	//known events match
+	seqKnown := sequential.KnownEvents()
+	batKnown := batched.KnownEvents()
+	for pid, index := range seqKnown {
+		if batKnown[pid] != index {
+			t.Fatalf("known[%d] should be %d, not %d", pid, index, batKnown[pid])
+		}
+	}
+
+	//per-participant lists match
+	for p := range participants {
+		seqEvents, err := sequential.ParticipantEvents(p, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		batEvents, err := batched.ParticipantEvents(p, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(seqEvents) != len(batEvents) {
+			t.Fatalf("participant %s: expected %d events, got %d", p, len(seqEvents), len(batEvents))
+		}
+		for i := range seqEvents {
+			if seqEvents[i] != batEvents[i] {
+				t.Fatalf("participant %s: lists differ at %d", p, i)
+			}
+		}
+	}
+
+	//every event is retrievable
+	for _, comet := range comets {
+		if _, err := batched.GetComet(comet.Hex()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
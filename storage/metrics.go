@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+//storeMetrics holds the internal counters. They are updated with atomic
+//operations so the hot paths stay lock-free.
+type storeMetrics struct {
+	reads       uint64
+	writes      uint64
+	cacheHits   uint64
+	cacheMisses uint64
+	errors      uint64
+	//events actually written vs skipped by dbSetEvents' existence probe,
+	//see dedup
+	eventsWritten uint64
+	eventsDeduped uint64
+}
+
+func (m *storeMetrics) read(cacheHit bool, err error) {
+	atomic.AddUint64(&m.reads, 1)
+	if cacheHit {
+		atomic.AddUint64(&m.cacheHits, 1)
+	} else {
+		atomic.AddUint64(&m.cacheMisses, 1)
+	}
+	if err != nil {
+		atomic.AddUint64(&m.errors, 1)
+	}
+}
+
+func (m *storeMetrics) write(err error) {
+	atomic.AddUint64(&m.writes, 1)
+	if err != nil {
+		atomic.AddUint64(&m.errors, 1)
+	}
+}
+
+//dedup records the outcome of a batch of event writes: how many were new
+//and how many were already present and skipped. The dedup count is how much
+//redundant gossip the node is receiving.
+func (m *storeMetrics) dedup(written, skipped int) {
+	if written > 0 {
+		atomic.AddUint64(&m.eventsWritten, uint64(written))
+	}
+	if skipped > 0 {
+		atomic.AddUint64(&m.eventsDeduped, uint64(skipped))
+	}
+}
+
+//StoreMetricsSnapshot is a point-in-time view of the store counters. It is
+//plain data so callers can convert it to Prometheus gauges/counters without
+//the storage package importing a metrics library.
+type StoreMetricsSnapshot struct {
+	Reads         uint64
+	Writes        uint64
+	CacheHits     uint64
+	CacheMisses   uint64
+	CacheHitRatio float64
+	Errors        uint64
+	EventsWritten uint64
+	EventsDeduped uint64
+	LsmSize       int64
+	VlogSize      int64
+}
+
+//Metrics returns a snapshot of the store counters and the on-disk sizes.
+//Gathering is cheap: a handful of atomic loads and badger's cached size.
+func (s *BadgerStore) Metrics() StoreMetricsSnapshot {
+	snap := StoreMetricsSnapshot{
+		Reads:       atomic.LoadUint64(&s.metrics.reads),
+		Writes:      atomic.LoadUint64(&s.metrics.writes),
+		CacheHits:   atomic.LoadUint64(&s.metrics.cacheHits),
+		CacheMisses: atomic.LoadUint64(&s.metrics.cacheMisses),
+		Errors:      atomic.LoadUint64(&s.metrics.errors),
+
+		EventsWritten: atomic.LoadUint64(&s.metrics.eventsWritten),
+		EventsDeduped: atomic.LoadUint64(&s.metrics.eventsDeduped),
+	}
+	if total := snap.CacheHits + snap.CacheMisses; total > 0 {
+		snap.CacheHitRatio = float64(snap.CacheHits) / float64(total)
+	}
+	snap.LsmSize, snap.VlogSize = s.db.Size()
+	return snap
+}
+
+//creatorCounts tracks per-participant event ingestion since the last
+//snapshot. A plain map under a mutex is enough here: the increment is one
+//map bump per accepted event, dwarfed by the write it accompanies.
+type creatorCounts struct {
+	lock   sync.Mutex
+	counts map[string]uint64
+}
+
+func (c *creatorCounts) inc(creator string) {
+	c.lock.Lock()
+	if c.counts == nil {
+		c.counts = make(map[string]uint64)
+	}
+	c.counts[creator]++
+	c.lock.Unlock()
+}
+
+//ParticipantEventRates returns how many events each creator has had
+//accepted since the last resetting call, so operators can spot a flooding
+//or stalled validator by sampling at a fixed interval. With reset true the
+//counters start over, turning successive calls into per-interval rates.
+func (s *BadgerStore) ParticipantEventRates(reset bool) map[string]uint64 {
+	s.creatorRates.lock.Lock()
+	defer s.creatorRates.lock.Unlock()
+	res := make(map[string]uint64, len(s.creatorRates.counts))
+	for creator, count := range s.creatorRates.counts {
+		res[creator] = count
+	}
+	if reset {
+		s.creatorRates.counts = nil
+	}
+	return res
+}
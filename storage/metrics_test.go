@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/paradigm-network/paradigm/types"
+)
+
+func TestMetricsSnapshot(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	//one write
+	cached := newTestComet(0xAA, 0, 0)
+	if err := store.SetComet(cached); err != nil {
+		t.Fatal(err)
+	}
+
+	//one cache hit
+	if _, err := store.GetComet(cached.Hex()); err != nil {
+		t.Fatal(err)
+	}
+
+	//one cache miss served from disk
+	disk := newTestComet(0xBB, 0, 1)
+	raw, err := disk.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetEventBytes(disk.Hex(), 1, 0, "0xBB", raw); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GetComet(disk.Hex()); err != nil {
+		t.Fatal(err)
+	}
+
+	//one failed read
+	if _, err := store.GetComet("0xNOPE"); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	snap := store.Metrics()
+	if snap.Writes != 1 {
+		t.Fatalf("expected 1 write, got %d", snap.Writes)
+	}
+	if snap.Reads != 3 {
+		t.Fatalf("expected 3 reads, got %d", snap.Reads)
+	}
+	if snap.CacheHits != 1 {
+		t.Fatalf("expected 1 cache hit, got %d", snap.CacheHits)
+	}
+	if snap.CacheMisses != 2 {
+		t.Fatalf("expected 2 cache misses, got %d", snap.CacheMisses)
+	}
+	if snap.Errors != 1 {
+		t.Fatalf("expected 1 error, got %d", snap.Errors)
+	}
+	if snap.CacheHitRatio <= 0 || snap.CacheHitRatio >= 1 {
+		t.Fatalf("expected a ratio in (0,1), got %f", snap.CacheHitRatio)
+	}
+
+	//a block write is counted too
+	if err := store.SetBlock(types.NewBlock(0, 1, [][]byte{[]byte("tx")})); err != nil {
+		t.Fatal(err)
+	}
+	if snap = store.Metrics(); snap.Writes != 2 {
+		t.Fatalf("expected 2 writes, got %d", snap.Writes)
+	}
+}
+
+func TestParticipantEventRates(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	for i := 0; i < 3; i++ {
+		comet := newTestComet(0xAA, i, i)
+		if err := store.SetComet(comet); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.SetComet(newTestComet(0xBB, 0, 3)); err != nil {
+		t.Fatal(err)
+	}
+
+	aa := fmt.Sprintf("0x%X", []byte{0xAA})
+	bb := fmt.Sprintf("0x%X", []byte{0xBB})
+	rates := store.ParticipantEventRates(true)
+	if rates[aa] != 3 || rates[bb] != 1 {
+		t.Fatalf("expected rates 3/1, got %d/%d", rates[aa], rates[bb])
+	}
+
+	//the resetting call started a fresh interval
+	rates = store.ParticipantEventRates(false)
+	if len(rates) != 0 {
+		t.Fatalf("expected empty rates after reset, got %v", rates)
+	}
+}
+
+func TestDedupCounters(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	comet := newTestComet(0xAA, 0, 0)
+	if err := store.SetComet(comet); err != nil {
+		t.Fatal(err)
+	}
+	snap := store.Metrics()
+	if snap.EventsWritten != 1 || snap.EventsDeduped != 0 {
+		t.Fatalf("expected 1 written / 0 deduped, got %d / %d",
+			snap.EventsWritten, snap.EventsDeduped)
+	}
+
+	//the same event again is detected as present and only re-written, not
+	//re-indexed
+	if err := store.dbSetEvents([]types.Comet{comet}); err != nil {
+		t.Fatal(err)
+	}
+	snap = store.Metrics()
+	if snap.EventsWritten != 1 || snap.EventsDeduped != 1 {
+		t.Fatalf("expected 1 written / 1 deduped, got %d / %d",
+			snap.EventsWritten, snap.EventsDeduped)
+	}
+
+	//a mixed batch splits between the counters
+	if err := store.dbSetEvents([]types.Comet{comet, newTestComet(0xBB, 0, 1)}); err != nil {
+		t.Fatal(err)
+	}
+	snap = store.Metrics()
+	if snap.EventsWritten != 2 || snap.EventsDeduped != 2 {
+		t.Fatalf("expected 2 written / 2 deduped, got %d / %d",
+			snap.EventsWritten, snap.EventsDeduped)
+	}
+}
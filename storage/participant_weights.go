@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"fmt"
+	"strconv"
+)
+
+//Participant weights extend the pubkey->id participant map with an optional
+//stake for weighted voting. A participant without an explicit weight counts
+//as weight 1, so unweighted networks keep behaving exactly as before.
+
+func participantWeightKey(pubKey string) []byte {
+	return []byte(fmt.Sprintf("%s_%s", participantWeightPrefix, pubKey))
+}
+
+//SetParticipantWeight persists an explicit stake for a participant and
+//invalidates the cached total.
+func (s *BadgerStore) SetParticipantWeight(pubKey string, weight uint64) error {
+	if err := s.kv.Set(participantWeightKey(pubKey), []byte(strconv.FormatUint(weight, 10))); err != nil {
+		return err
+	}
+	s.weightLock.Lock()
+	if s.weights != nil {
+		s.weights[pubKey] = weight
+	}
+	s.totalWeight = -1
+	s.weightLock.Unlock()
+	return nil
+}
+
+//ParticipantWeight returns a participant's stake and whether it was set
+//explicitly. Participants without an explicit weight - including unknown
+//pubkeys - weigh the default 1. A failure to load the weights from the db
+//is logged and reported as the default, so a broken disk degrades voting
+//to unweighted visibly rather than silently; callers that must distinguish
+//the two use TotalWeight, which propagates the error.
+func (s *BadgerStore) ParticipantWeight(pubKey string) (uint64, bool) {
+	s.weightLock.Lock()
+	defer s.weightLock.Unlock()
+	if err := s.loadWeights(); err != nil {
+		s.logger.Error().Err(err).Str("pubKey", pubKey).Msg("loading participant weights failed")
+		return 1, false
+	}
+	if w, ok := s.weights[pubKey]; ok {
+		return w, true
+	}
+	return 1, false
+}
+
+//TotalWeight returns the summed stake of the whole participant set, using
+//explicit weights where present and the default 1 elsewhere. The sum is
+//cached until a weight changes or a participant is added.
+func (s *BadgerStore) TotalWeight() (uint64, error) {
+	s.weightLock.Lock()
+	defer s.weightLock.Unlock()
+	if s.totalWeight >= 0 {
+		return uint64(s.totalWeight), nil
+	}
+	if err := s.loadWeights(); err != nil {
+		return 0, err
+	}
+	participants, err := s.Participants()
+	if err != nil {
+		return 0, err
+	}
+	var total uint64
+	for pk := range participants {
+		if w, ok := s.weights[pk]; ok {
+			total += w
+		} else {
+			total++
+		}
+	}
+	s.totalWeight = int64(total)
+	return total, nil
+}
+
+//loadWeights seeds the in-memory weight cache from the db once. Callers
+//must hold weightLock.
+func (s *BadgerStore) loadWeights() error {
+	if s.weights != nil {
+		return nil
+	}
+	weights := map[string]uint64{}
+	prefix := []byte(participantWeightPrefix + "_")
+	err := s.kv.Iterate(prefix, false, func(key, value []byte) error {
+		w, err := strconv.ParseUint(string(value), 10, 64)
+		if err != nil {
+			return nil
+		}
+		weights[string(key)[len(prefix):]] = w
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.weights = weights
+	return nil
+}
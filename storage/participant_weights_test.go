@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParticipantWeights(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer os.RemoveAll(dir)
+
+	//without explicit weights everyone weighs 1
+	if w, explicit := store.ParticipantWeight("0xAA"); w != 1 || explicit {
+		t.Fatalf("expected the default weight 1, got %d (explicit=%v)", w, explicit)
+	}
+	total, err := store.TotalWeight()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 3 {
+		t.Fatalf("expected total 3 for three default participants, got %d", total)
+	}
+
+	if err := store.SetParticipantWeight("0xAA", 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetParticipantWeight("0xBB", 5); err != nil {
+		t.Fatal(err)
+	}
+
+	if w, explicit := store.ParticipantWeight("0xAA"); w != 10 || !explicit {
+		t.Fatalf("expected explicit weight 10, got %d (explicit=%v)", w, explicit)
+	}
+	if w, explicit := store.ParticipantWeight("0xCC"); w != 1 || explicit {
+		t.Fatalf("expected 0xCC to keep the default, got %d (explicit=%v)", w, explicit)
+	}
+
+	//10 + 5 + the default 1
+	total, err = store.TotalWeight()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 16 {
+		t.Fatalf("expected total 16, got %d", total)
+	}
+
+	//weights survive a restart
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := LoadBadgerStore(10, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Close()
+
+	if w, explicit := reloaded.ParticipantWeight("0xBB"); w != 5 || !explicit {
+		t.Fatalf("expected weight 5 after reload, got %d (explicit=%v)", w, explicit)
+	}
+	total, err = reloaded.TotalWeight()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 16 {
+		t.Fatalf("expected total 16 after reload, got %d", total)
+	}
+
+	//adding a participant invalidates the cached sum
+	if err := reloaded.AddParticipant("0xDD", 3); err != nil {
+		t.Fatal(err)
+	}
+	total, err = reloaded.TotalWeight()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 17 {
+		t.Fatalf("expected total 17 with the new default member, got %d", total)
+	}
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"github.com/dgraph-io/badger"
+	"github.com/paradigm-network/paradigm/types"
+)
+
+//ReadRepair rewrites every cached comet, block and round that is missing
+//from disk. A crash can lose the tail of the value log while the cache still
+//holds the entries, so the cache is treated as the source of truth here. It
+//returns the number of entries repaired.
+func (s *BadgerStore) ReadRepair() (int, error) {
+	repaired := 0
+
+	for _, key := range s.inmemStore.eventCache.Keys() {
+		hex := key.(string)
+		missing, err := s.missingFromDisk([]byte(hex))
+		if err != nil {
+			return repaired, err
+		}
+		if !missing {
+			continue
+		}
+		cached, ok := s.inmemStore.eventCache.Peek(hex)
+		if !ok {
+			continue
+		}
+		if err := s.dbSetEvents([]types.Comet{cached.(types.Comet)}); err != nil {
+			return repaired, err
+		}
+		repaired++
+	}
+
+	for _, key := range s.inmemStore.blockCache.Keys() {
+		index := key.(int)
+		missing, err := s.missingFromDisk(blockKey(index))
+		if err != nil {
+			return repaired, err
+		}
+		if !missing {
+			continue
+		}
+		cached, ok := s.inmemStore.blockCache.Peek(index)
+		if !ok {
+			continue
+		}
+		if err := s.dbSetBlock(cached.(types.Block)); err != nil {
+			return repaired, err
+		}
+		repaired++
+	}
+
+	for _, key := range s.inmemStore.roundCache.Keys() {
+		index := key.(int)
+		missing, err := s.missingFromDisk(roundKey(index))
+		if err != nil {
+			return repaired, err
+		}
+		if !missing {
+			continue
+		}
+		cached, ok := s.inmemStore.roundCache.Peek(index)
+		if !ok {
+			continue
+		}
+		if err := s.dbSetRound(index, cached.(types.RoundInfo)); err != nil {
+			return repaired, err
+		}
+		repaired++
+	}
+
+	return repaired, nil
+}
+
+func (s *BadgerStore) missingFromDisk(key []byte) (bool, error) {
+	err := s.db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get(key)
+		return err
+	})
+	if err == nil {
+		return false, nil
+	}
+	if isDBKeyNotFound(err) {
+		return true, nil
+	}
+	return false, err
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/paradigm-network/paradigm/types"
+)
+
+func TestReadRepair(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer removeBadgerStore(store, dir)
+
+	//a fully synced store needs no repairs
+	comet := newTestComet(0xAA, 0, 0)
+	if err := store.SetComet(comet); err != nil {
+		t.Fatal(err)
+	}
+	repaired, err := store.ReadRepair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repaired != 0 {
+		t.Fatalf("expected 0 repairs, got %d", repaired)
+	}
+
+	//simulate a torn write: cache-only entries of each kind
+	lost := newTestComet(0xBB, 0, 1)
+	if err := store.inmemStore.SetComet(lost); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.inmemStore.SetBlock(types.NewBlock(0, 1, [][]byte{[]byte("tx")})); err != nil {
+		t.Fatal(err)
+	}
+	round := types.NewRoundInfo()
+	round.AddEvent(lost.Hex(), true)
+	if err := store.inmemStore.SetRound(0, *round); err != nil {
+		t.Fatal(err)
+	}
+
+	repaired, err = store.ReadRepair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repaired != 3 {
+		t.Fatalf("expected 3 repairs, got %d", repaired)
+	}
+
+	//the repaired entries are now durable
+	if _, err := store.dbGetEvent(lost.Hex()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.dbGetBlock(0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.dbGetRound(0); err != nil {
+		t.Fatal(err)
+	}
+
+	//a second pass finds nothing left to do
+	if repaired, err = store.ReadRepair(); err != nil || repaired != 0 {
+		t.Fatalf("expected a clean second pass, got %d repairs and err %v", repaired, err)
+	}
+}
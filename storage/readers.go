@@ -0,0 +1,221 @@
+package storage
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/dgraph-io/badger"
+	"github.com/paradigm-network/paradigm/errors"
+	"github.com/paradigm-network/paradigm/types"
+)
+
+//StoreReader is a tracked long-lived read transaction. The streaming APIs
+//hand these out so the store can count how many are open and stop a leaking
+//consumer from pinning the value log and starving GC.
+type StoreReader struct {
+	s    *BadgerStore
+	txn  *badger.Txn
+	once sync.Once
+}
+
+//OpenReader opens a tracked read transaction. When the configured
+//MaxOpenReaders is reached it returns an errors.TooManyReaders error. The
+//caller must Close the reader when done.
+func (s *BadgerStore) OpenReader() (*StoreReader, error) {
+	if err := s.acquireReader(); err != nil {
+		return nil, err
+	}
+	return &StoreReader{s: s, txn: s.db.NewTransaction(false)}, nil
+}
+
+//Txn exposes the underlying transaction for iteration
+func (r *StoreReader) Txn() *badger.Txn {
+	return r.txn
+}
+
+//Close discards the transaction and releases its reader slot. It is safe to
+//call more than once.
+func (r *StoreReader) Close() {
+	r.once.Do(func() {
+		r.txn.Discard()
+		r.s.releaseReader()
+	})
+}
+
+func (s *BadgerStore) acquireReader() error {
+	max := int64(s.conf.MaxOpenReaders)
+	if max <= 0 {
+		atomic.AddInt64(&s.openReaders, 1)
+		return nil
+	}
+	for {
+		cur := atomic.LoadInt64(&s.openReaders)
+		if cur >= max {
+			return errors.NewStoreErr(errors.TooManyReaders, strconv.FormatInt(cur, 10))
+		}
+		if atomic.CompareAndSwapInt64(&s.openReaders, cur, cur+1) {
+			return nil
+		}
+	}
+}
+
+func (s *BadgerStore) releaseReader() {
+	atomic.AddInt64(&s.openReaders, -1)
+}
+
+//OpenReaders reports how many tracked read transactions are currently open
+func (s *BadgerStore) OpenReaders() int {
+	return int(atomic.LoadInt64(&s.openReaders))
+}
+
+//TopologicalCursor pages through the topological event order while holding
+//one tracked read transaction, so sequential pagination (dump tools,
+//explorers) reuses iteration state instead of re-opening a View and
+//re-seeking per page. The cursor iterates the snapshot taken when it was
+//opened; events stored later are not visible through it. Close releases the
+//reader slot.
+type TopologicalCursor struct {
+	s      *BadgerStore
+	reader *StoreReader
+	next   int
+}
+
+//OpenTopologicalCursor opens a cursor at topological index 0. It counts
+//against MaxOpenReaders like any tracked reader; the caller must Close it.
+func (s *BadgerStore) OpenTopologicalCursor() (*TopologicalCursor, error) {
+	if s.conf.DisableTopoIndex {
+		return nil, errors.NewStoreErr(errors.IndexDisabled, topoPrefix)
+	}
+	reader, err := s.OpenReader()
+	if err != nil {
+		return nil, err
+	}
+	return &TopologicalCursor{s: s, reader: reader}, nil
+}
+
+//Next returns up to limit events from the current position and advances it.
+//An empty slice means the end of the order has been reached.
+func (c *TopologicalCursor) Next(limit int) ([]types.Comet, error) {
+	res := []types.Comet{}
+	txn := c.reader.Txn()
+	for len(res) < limit {
+		hash := ""
+		if c.s.conf.LazyTopoIndex {
+			c.s.pendingTopoLock.Lock()
+			hash = c.s.pendingTopo[c.next]
+			c.s.pendingTopoLock.Unlock()
+		}
+		if hash == "" {
+			item, err := txn.Get(topologicalEventKey(c.next))
+			if err != nil {
+				if isDBKeyNotFound(err) {
+					return res, nil
+				}
+				return res, err
+			}
+			v, err := item.Value()
+			if err != nil {
+				return res, err
+			}
+			hash = string(v)
+		}
+		comet, err := c.s.GetComet(hash)
+		if err != nil {
+			return res, err
+		}
+		res = append(res, comet)
+		c.next++
+	}
+	return res, nil
+}
+
+//Close releases the cursor's reader slot. Safe to call more than once.
+func (c *TopologicalCursor) Close() {
+	c.reader.Close()
+}
+
+//ReadTxn offers the typed getters over one shared badger read transaction.
+//A caller assembling a complex view (a full round with witnesses and their
+//parents, say) would otherwise open one View per getter; through a ReadTxn
+//all db reads see a single consistent snapshot and pay one transaction
+//setup. The cache is still consulted first for each key.
+type ReadTxn struct {
+	s   *BadgerStore
+	txn *badger.Txn
+}
+
+//View runs fn against one shared read transaction, see ReadTxn
+func (s *BadgerStore) View(fn func(r ReadTxn) error) error {
+	txn := s.db.NewTransaction(false)
+	defer txn.Discard()
+	return fn(ReadTxn{s: s, txn: txn})
+}
+
+func (r ReadTxn) get(key []byte) ([]byte, error) {
+	item, err := r.txn.Get(key)
+	if err != nil {
+		return nil, mapError(err, string(key))
+	}
+	return item.Value()
+}
+
+func (r ReadTxn) GetComet(key string) (types.Comet, error) {
+	if comet, err := r.s.inmemStore.GetComet(key); err == nil {
+		return comet, nil
+	}
+	v, err := r.get([]byte(key))
+	if err != nil {
+		return types.Comet{}, err
+	}
+	comet := new(types.Comet)
+	if err := r.s.codec.Unmarshal(v, comet); err != nil {
+		return types.Comet{}, errors.NewStoreErr(errors.DecodeError, key)
+	}
+	return *comet, nil
+}
+
+func (r ReadTxn) GetRound(index int) (types.RoundInfo, error) {
+	if round, err := r.s.inmemStore.GetRound(index); err == nil {
+		return round, nil
+	}
+	v, err := r.get(roundKey(index))
+	if err != nil {
+		return *types.NewRoundInfo(), err
+	}
+	round := new(types.RoundInfo)
+	if err := round.Unmarshal(v); err != nil {
+		return *types.NewRoundInfo(), errors.NewStoreErr(errors.DecodeError, string(roundKey(index)))
+	}
+	return *round, nil
+}
+
+func (r ReadTxn) GetBlock(index int) (types.Block, error) {
+	if block, err := r.s.inmemStore.GetBlock(index); err == nil {
+		return block, nil
+	}
+	v, err := r.get(blockKey(index))
+	if err != nil {
+		return types.Block{}, err
+	}
+	block := new(types.Block)
+	if err := block.Unmarshal(v); err != nil {
+		return types.Block{}, errors.NewStoreErr(errors.DecodeError, string(blockKey(index)))
+	}
+	return *block, nil
+}
+
+func (r ReadTxn) GetRoot(participant string) (types.Root, error) {
+	if root, err := r.s.inmemStore.GetRoot(participant); err == nil {
+		return root, nil
+	}
+	v, err := r.get(participantRootKey(participant))
+	if err != nil {
+		return types.Root{}, err
+	}
+	root := new(types.Root)
+	if err := root.Unmarshal(v); err != nil {
+		return types.Root{}, errors.NewStoreErr(errors.DecodeError, string(participantRootKey(participant)))
+	}
+	return *root, nil
+}
@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"os"
+	"time"
+)
+
+//StoreConfig holds optional knobs for the storage layer.
+//The zero value preserves the historical behaviour of the store.
+type StoreConfig struct {
+	//DisableParticipantIndex skips writing the per-participant event index.
+	//ParticipantEvents/ParticipantEvent lookups that would hit the db will
+	//return an errors.IndexDisabled error.
+	DisableParticipantIndex bool
+
+	//DisableTopoIndex skips writing the topological event index.
+	//DbTopologicalEvents will return an errors.IndexDisabled error.
+	DisableTopoIndex bool
+
+	//MaxConcurrentWrites bounds the number of in-flight write transactions
+	//to smooth memory usage under bursty load. 0 means unlimited.
+	MaxConcurrentWrites int
+
+	//RouteBadgerLogs forwards badger's internal logging to the zerolog
+	//"badger" component logger. The vendored badger has no per-DB logger:
+	//it writes through the stdlib's process-global logger, so opting in
+	//redirects that logger for the WHOLE process, and the redirection is
+	//applied once - the first store opened with the option wins and later
+	//stores cannot change it. Off by default, leaving the stdlib logger
+	//untouched.
+	RouteBadgerLogs bool
+
+	//SilenceBadgerLogs discards badger's internal logging instead of
+	//forwarding it. Like RouteBadgerLogs this redirects the process-global
+	//stdlib logger, once, first store wins; it takes precedence over
+	//RouteBadgerLogs when both are set on that first store.
+	SilenceBadgerLogs bool
+
+	//DirPerm is the permission mode used when the constructor has to create
+	//the database directory, enforced regardless of the process umask.
+	//Zero means the default of 0700.
+	DirPerm os.FileMode
+
+	//WriteBufferSize, when >0, queues the durable part of SetComet to a
+	//background flusher that batches events into single transactions. The
+	//cache is still updated synchronously so reads remain coherent.
+	WriteBufferSize int
+
+	//NonBlockingWrites makes SetComet return an errors.Backpressure error
+	//when the write buffer is full instead of blocking until it drains.
+	//Only meaningful together with WriteBufferSize.
+	NonBlockingWrites bool
+
+	//MaxOpenReaders bounds the number of simultaneously open tracked read
+	//transactions (see OpenReader). Long-lived iterators pin badger's value
+	//log and can block GC; exceeding the limit yields an
+	//errors.TooManyReaders error. 0 means unlimited.
+	MaxOpenReaders int
+
+	//OpenTimeout bounds how long the constructors wait for badger.Open,
+	//which can spend a long time replaying the value log on slow disks.
+	//Exceeding it yields an errors.OpenTimeout error. 0 means no timeout.
+	OpenTimeout time.Duration
+
+	//Codec selects how comets are encoded on disk: "default" (or empty) is
+	//the compact encoding, "json" stores indented JSON for inspectability
+	//on test/dev networks. The choice is recorded in the store so it is
+	//never read back with the wrong codec.
+	Codec string
+
+	//StrictBlockOrder makes SetBlock reject a block whose index is not
+	//exactly one past the last stored block with an errors.NonContiguousBlock
+	//error, protecting the contiguous-range assumptions downstream. The
+	//first block of an empty store may use any index. Off by default.
+	StrictBlockOrder bool
+
+	//StrictCreators makes SetComet reject events whose creator is not a
+	//known participant with an errors.UnknownCreator error, before anything
+	//is written. Off by default so flows that add participants after their
+	//first events keep working.
+	StrictCreators bool
+
+	//LazyTopoIndex keeps the topological ordering index in memory and only
+	//flushes it to disk in batches (and on Close), cutting per-write
+	//amplification on nodes whose cache absorbs most topo reads.
+	//DbTopologicalEvents merges the unflushed tail with the disk state.
+	LazyTopoIndex bool
+
+	//MaxConflictRetries bounds how often a multi-key update transaction is
+	//re-run when its commit hits a badger ErrConflict under contention.
+	//0 means the default of 5 attempts.
+	MaxConflictRetries int
+
+	//MetadataPath, when set, opens a second badger directory dedicated to
+	//the raw Get/Has/Put KV namespace so high-churn application state does
+	//not interfere with compaction of the write-once consensus data. Empty
+	//means both share the one db, as before.
+	MetadataPath string
+
+	//PinKeys lists logical entities pinned into the cache at load and
+	//refresh time, immune to eviction: "last-round" and "last-block" pin
+	//the most recent round and block, "roots" is accepted for completeness
+	//(roots are always resident). Unknown names are rejected at open.
+	PinKeys []string
+
+	//WarmOnLoad makes LoadBadgerStoreWithConfig preload the last WarmRounds
+	//rounds and the tail of the persisted consensus list into the InmemStore,
+	//trading a slightly slower open for a faster first consensus tick.
+	WarmOnLoad bool
+
+	//WarmRounds is how many of the most recent rounds WarmOnLoad preloads.
+	//0 means the store's cache size.
+	WarmRounds int
+
+	//AutoGCInterval, when >0, starts a background goroutine that checks the
+	//value-log size at this interval and garbage-collects it until badger
+	//reports nothing left to rewrite. 0 leaves GC to the caller.
+	AutoGCInterval time.Duration
+
+	//AutoGCDiscardRatio is the discard ratio handed to RunValueLogGC: a
+	//value-log file is only rewritten when at least this fraction of it is
+	//reclaimable. Must be in (0,1); 0 means the default of 0.5.
+	AutoGCDiscardRatio float64
+
+	//EnableRootHistory keeps an append-only history of participant roots,
+	//written whenever dbSetRoots overwrites an existing root. Off by
+	//default to avoid write amplification.
+	EnableRootHistory bool
+}
+
+//There is deliberately no BlockCacheSize knob: badger's block cache, and
+//the compression/encryption modes that require one, only exist from badger
+//v2 onwards. The vendored v1 engine stores tables uncompressed and has no
+//such option, so exposing the knob here would be a silent no-op. Revisit
+//when the engine is upgraded.
+
+//DefaultStoreConfig returns the configuration used when none is provided
+func DefaultStoreConfig() *StoreConfig {
+	return &StoreConfig{}
+}
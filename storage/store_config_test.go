@@ -0,0 +1,686 @@
+package storage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger"
+	"github.com/paradigm-network/paradigm/errors"
+	"github.com/paradigm-network/paradigm/types"
+)
+
+func initConfiguredBadgerStore(t *testing.T, conf *StoreConfig) (*BadgerStore, string) {
+	dir, err := ioutil.TempDir("", "badger")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	participants := map[string]int{
+		"0xAA": 0,
+		"0xBB": 1,
+		"0xCC": 2,
+	}
+
+	store, err := NewBadgerStoreWithConfig(participants, 10, dir, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return store, dir
+}
+
+func TestDisabledIndexes(t *testing.T) {
+	store, dir := initConfiguredBadgerStore(t, &StoreConfig{
+		DisableParticipantIndex: true,
+		DisableTopoIndex:        true,
+	})
+	defer removeBadgerStore(store, dir)
+
+	comet := newTestComet(0xAA, 0, 0)
+	if err := store.SetComet(comet); err != nil {
+		t.Fatal(err)
+	}
+
+	//the event itself is written
+	if _, err := store.dbGetEvent(comet.Hex()); err != nil {
+		t.Fatal(err)
+	}
+
+	//the index keys are not
+	if _, err := store.Get(topologicalEventKey(0)); err == nil {
+		t.Fatal("topo index should not have been written")
+	}
+	if _, err := store.Get(participantEventKey("0xAA", 0)); err == nil {
+		t.Fatal("participant index should not have been written")
+	}
+
+	//dependent reads report the disabled index
+	if _, err := store.DbTopologicalEvents(); !errors.Is(err, errors.IndexDisabled) {
+		t.Fatalf("DbTopologicalEvents should return IndexDisabled, not %v", err)
+	}
+	if _, err := store.dbParticipantEvents("0xAA", -1); !errors.Is(err, errors.IndexDisabled) {
+		t.Fatalf("dbParticipantEvents should return IndexDisabled, not %v", err)
+	}
+	if _, err := store.dbParticipantEvent("0xAA", 0); !errors.Is(err, errors.IndexDisabled) {
+		t.Fatalf("dbParticipantEvent should return IndexDisabled, not %v", err)
+	}
+}
+
+func TestMaxConcurrentWrites(t *testing.T) {
+	store, dir := initConfiguredBadgerStore(t, &StoreConfig{
+		MaxConcurrentWrites: 2,
+	})
+	defer removeBadgerStore(store, dir)
+
+	//a bounded store still accepts writes
+	if err := store.SetBlock(types.NewBlock(0, 1, [][]byte{[]byte("tx")})); err != nil {
+		t.Fatal(err)
+	}
+
+	var inFlight, maxInFlight int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			store.acquireWrite()
+			defer store.releaseWrite()
+
+			n := atomic.AddInt32(&inFlight, 1)
+			for {
+				max := atomic.LoadInt32(&maxInFlight)
+				if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&inFlight, -1)
+		}()
+	}
+	wg.Wait()
+
+	if max := atomic.LoadInt32(&maxInFlight); max > 2 {
+		t.Fatalf("expected at most 2 simultaneous writers, got %d", max)
+	}
+}
+
+func TestRootHistory(t *testing.T) {
+	store, dir := initConfiguredBadgerStore(t, &StoreConfig{
+		EnableRootHistory: true,
+	})
+	defer removeBadgerStore(store, dir)
+
+	//the constructor wrote the base roots; each subsequent set overwrites
+	//an existing root and must be recorded
+	for i, x := range []string{"first", "second"} {
+		root := types.NewBaseRoot()
+		root.X = x
+		root.Index = i
+		if err := store.dbSetRoots(map[string]types.Root{"0xAA": root}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	history, err := store.RootHistory("0xAA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("expected 2 history entries, got %d", len(history))
+	}
+	if history[0].X != "first" || history[1].X != "second" {
+		t.Fatalf("history out of order: %v", history)
+	}
+
+	//other participants have no history
+	history, err = store.RootHistory("0xBB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 0 {
+		t.Fatalf("expected empty history, got %d entries", len(history))
+	}
+}
+
+func TestDirPerm(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	//the constructor creates a missing directory with the requested mode
+	path := filepath.Join(dir, "nested", "db")
+	store, err := NewBadgerStoreWithConfig(map[string]int{"0xAA": 0}, 10, path, &StoreConfig{
+		DirPerm: 0750,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0750 {
+		t.Fatalf("expected mode 0750, got %o", perm)
+	}
+}
+
+func TestLoadBadgerStoreNotADirectory(t *testing.T) {
+	file, err := ioutil.TempFile("", "badger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	defer os.Remove(file.Name())
+
+	_, err = LoadBadgerStore(10, file.Name())
+	if err == nil {
+		t.Fatal("expected an error for a non-directory path")
+	}
+	if !strings.Contains(err.Error(), "not a directory") {
+		t.Fatalf("expected a clear not-a-directory error, got %v", err)
+	}
+}
+
+func TestOpenTimeout(t *testing.T) {
+	orig := badgerOpen
+	defer func() { badgerOpen = orig }()
+
+	//an open that outlasts the configured deadline
+	badgerOpen = func(opts badger.Options) (*badger.DB, error) {
+		time.Sleep(200 * time.Millisecond)
+		return nil, fmt.Errorf("open aborted")
+	}
+
+	dir, err := ioutil.TempDir("", "badger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := DefaultStoreConfig()
+	conf.OpenTimeout = 50 * time.Millisecond
+	_, err = NewBadgerStoreWithConfig(map[string]int{"0xAA": 0}, 10, dir, conf)
+	if !errors.Is(err, errors.OpenTimeout) {
+		t.Fatalf("expected OpenTimeout, got %v", err)
+	}
+
+	//a fast open is unaffected by the deadline
+	badgerOpen = orig
+	store, err := NewBadgerStoreWithConfig(map[string]int{"0xAA": 0}, 10, dir, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+}
+
+func TestWriteBuffer(t *testing.T) {
+	store, dir := initConfiguredBadgerStore(t, &StoreConfig{WriteBufferSize: 4})
+	defer removeBadgerStore(store, dir)
+
+	comet := newTestComet(0xAA, 0, 0)
+	if err := store.SetComet(comet); err != nil {
+		t.Fatal(err)
+	}
+
+	//the cache is updated synchronously
+	if _, err := store.inmemStore.GetComet(comet.Hex()); err != nil {
+		t.Fatal(err)
+	}
+
+	//the durable write lands asynchronously
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := store.dbGetEvent(comet.Hex()); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("buffered write never reached the db")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	depth, maxDepth, _ := store.WriteBufferStats()
+	if depth != 0 {
+		t.Fatalf("expected a drained buffer, got depth %d", depth)
+	}
+	if maxDepth < 1 {
+		t.Fatalf("expected maxDepth >= 1, got %d", maxDepth)
+	}
+}
+
+func TestWriteBufferBackpressure(t *testing.T) {
+	//a buffer with no flusher attached, so it stays full
+	buf := &writeBuffer{
+		ch:   make(chan types.Comet, 2),
+		done: make(chan struct{}),
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := buf.enqueue(newTestComet(0xAA, i, i), true); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	//full buffer with non-blocking writes: typed backpressure error
+	err := buf.enqueue(newTestComet(0xAA, 2, 2), true)
+	if !errors.Is(err, errors.Backpressure) {
+		t.Fatalf("expected Backpressure, got %v", err)
+	}
+
+	//full buffer with blocking writes: the enqueue waits for a drain
+	unblocked := make(chan struct{})
+	go func() {
+		buf.enqueue(newTestComet(0xAA, 2, 2), false)
+		close(unblocked)
+	}()
+	select {
+	case <-unblocked:
+		t.Fatal("enqueue should have blocked on a full buffer")
+	case <-time.After(50 * time.Millisecond):
+	}
+	<-buf.ch //drain one slot
+	select {
+	case <-unblocked:
+	case <-time.After(time.Second):
+		t.Fatal("enqueue should have resumed after the drain")
+	}
+
+	//three events were enqueued and none flushed
+	depth, maxDepth, _ := writeBufferStatsOf(buf)
+	if depth != 3 || maxDepth != 3 {
+		t.Fatalf("expected depth 3 and maxDepth 3, got %d and %d", depth, maxDepth)
+	}
+}
+
+func writeBufferStatsOf(buf *writeBuffer) (int, int, time.Duration) {
+	s := &BadgerStore{writeBuf: buf}
+	return s.WriteBufferStats()
+}
+
+func TestMaxOpenReaders(t *testing.T) {
+	store, dir := initConfiguredBadgerStore(t, &StoreConfig{MaxOpenReaders: 2})
+	defer removeBadgerStore(store, dir)
+
+	first, err := store.OpenReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := store.OpenReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+
+	//the limit is enforced
+	if _, err := store.OpenReader(); !errors.Is(err, errors.TooManyReaders) {
+		t.Fatalf("expected TooManyReaders, got %v", err)
+	}
+
+	//closing a reader frees its slot
+	first.Close()
+	third, err := store.OpenReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//a reader can actually read
+	if _, err := third.Txn().Get(participantKey("0xAA")); err != nil {
+		t.Fatal(err)
+	}
+
+	//double close does not over-release
+	third.Close()
+	third.Close()
+	if n := store.OpenReaders(); n != 1 {
+		t.Fatalf("expected 1 open reader, got %d", n)
+	}
+}
+
+func TestAutoGC(t *testing.T) {
+	store, dir := initConfiguredBadgerStore(t, &StoreConfig{
+		AutoGCInterval:     5 * time.Millisecond,
+		AutoGCDiscardRatio: 0.5,
+	})
+	defer removeBadgerStore(store, dir)
+
+	if store.gc == nil {
+		t.Fatal("expected a gc runner to be started")
+	}
+
+	for i := 0; i < 20; i++ {
+		if err := store.SetComet(newTestComet(0xAA, i, i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	//drive cycles directly; an idle value log is not an error
+	for i := 0; i < 3; i++ {
+		reclaimed, err := store.runGCCycle(0.5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reclaimed < 0 {
+			t.Fatalf("reclaimed bytes should never be negative, got %d", reclaimed)
+		}
+	}
+
+	//let the background runner tick a few times before Close exercises the
+	//shutdown handshake
+	time.Sleep(25 * time.Millisecond)
+}
+
+func TestMetadataPath(t *testing.T) {
+	metaDir, err := ioutil.TempDir("", "badgermeta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(metaDir)
+
+	store, dir := initConfiguredBadgerStore(t, &StoreConfig{MetadataPath: metaDir})
+	defer removeBadgerStore(store, dir)
+
+	if store.metaDB == nil {
+		t.Fatal("expected a separate metadata db")
+	}
+
+	//app-state writes land in the metadata db only
+	if err := store.Put([]byte("appstate_foo"), []byte("bar")); err != nil {
+		t.Fatal(err)
+	}
+	v, err := store.Get([]byte("appstate_foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(v) != "bar" {
+		t.Fatalf("expected bar, got %s", string(v))
+	}
+	if _, err := store.kv.Get([]byte("appstate_foo")); !isDBKeyNotFound(err) {
+		t.Fatal("app-state key leaked into the consensus db")
+	}
+
+	//consensus writes keep going to the main db
+	if err := store.AddConsensusEvent("e0"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.kv.Get(consensusEventKey(0)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.appKV.Get(consensusEventKey(0)); !isDBKeyNotFound(err) {
+		t.Fatal("consensus key leaked into the metadata db")
+	}
+}
+
+func TestUpdateConflictRetry(t *testing.T) {
+	store, dir := initConfiguredBadgerStore(t, &StoreConfig{MaxConflictRetries: 20})
+	defer removeBadgerStore(store, dir)
+
+	key := []byte("counter")
+	if err := store.kv.Set(key, []byte("0")); err != nil {
+		t.Fatal(err)
+	}
+
+	increment := func(txn kvTxn) error {
+		v, err := txn.Get(key)
+		if err != nil {
+			return err
+		}
+		n, err := strconv.Atoi(string(v))
+		if err != nil {
+			return err
+		}
+		return txn.Set(key, []byte(strconv.Itoa(n+1)))
+	}
+
+	//two writers race read-modify-writes on the same key; every increment
+	//must survive thanks to the conflict retries
+	const perWriter = 10
+	var wg sync.WaitGroup
+	for w := 0; w < 2; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				if err := store.update(increment); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	v, err := store.kv.Get(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(v) != strconv.Itoa(2*perWriter) {
+		t.Fatalf("expected %d increments, got %s", 2*perWriter, string(v))
+	}
+}
+
+func TestWarmOnLoad(t *testing.T) {
+	store, dir := initBadgerStore(t, 10)
+	defer os.RemoveAll(dir)
+
+	for r := 0; r < 4; r++ {
+		round := types.NewRoundInfo()
+		round.AddEvent(fmt.Sprintf("w%d", r), true)
+		if err := store.SetRound(r, *round); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, key := range []string{"e0", "e1", "e2"} {
+		if err := store.AddConsensusEvent(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := LoadBadgerStoreWithConfig(10, dir, &StoreConfig{
+		WarmOnLoad: true,
+		WarmRounds: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Close()
+
+	//the last WarmRounds rounds are cache hits, older ones stay cold
+	for _, r := range []int{2, 3} {
+		if _, err := reloaded.inmemStore.GetRound(r); err != nil {
+			t.Fatalf("round %d should be warmed: %v", r, err)
+		}
+	}
+	if _, err := reloaded.inmemStore.GetRound(0); err == nil {
+		t.Fatal("round 0 should not be warmed with WarmRounds=2")
+	}
+	if lr := reloaded.LastRound(); lr != 3 {
+		t.Fatalf("expected last round 3, got %d", lr)
+	}
+
+	//the consensus list is warm too
+	warm := reloaded.inmemStore.ConsensusEvents()
+	if len(warm) != 3 {
+		t.Fatalf("expected 3 warmed consensus events, got %d", len(warm))
+	}
+	if c := reloaded.ConsensusEventsCount(); c != 3 {
+		t.Fatalf("expected consensus count 3, got %d", c)
+	}
+}
+
+func TestLazyTopoIndex(t *testing.T) {
+	store, dir := initConfiguredBadgerStore(t, &StoreConfig{LazyTopoIndex: true})
+	defer os.RemoveAll(dir)
+
+	comets := []types.Comet{}
+	for i := 0; i < 3; i++ {
+		comet := newTestComet(0xAA, i, i)
+		comets = append(comets, comet)
+		if err := store.SetComet(comet); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	//topo entries stay buffered, not on disk
+	if _, err := store.kvGet(topologicalEventKey(0)); !isDBKeyNotFound(err) {
+		t.Fatal("topo entry should not be on disk before a flush")
+	}
+
+	//a flush moves the buffered entries to disk
+	if err := store.flushTopoIndex(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.kvGet(topologicalEventKey(0)); err != nil {
+		t.Fatal(err)
+	}
+
+	//events straddling the flush boundary come back in topo order
+	for i := 3; i < 6; i++ {
+		comet := newTestComet(0xBB, i-3, i)
+		comets = append(comets, comet)
+		if err := store.SetComet(comet); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ordered, err := store.DbTopologicalEvents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ordered) != len(comets) {
+		t.Fatalf("expected %d events, got %d", len(comets), len(ordered))
+	}
+	for i := range comets {
+		if ordered[i].Hex() != comets[i].Hex() {
+			t.Fatalf("topo order broken at position %d", i)
+		}
+	}
+	if c, err := store.EventsCount(); err != nil || c != len(comets) {
+		t.Fatalf("expected events count %d, got %d (%v)", len(comets), c, err)
+	}
+
+	//Close flushes the remaining tail
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := LoadBadgerStore(10, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Close()
+	persisted, err := reloaded.DbTopologicalEvents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(persisted) != len(comets) {
+		t.Fatalf("expected %d persisted topo entries, got %d", len(comets), len(persisted))
+	}
+}
+
+func TestStrictBlockOrder(t *testing.T) {
+	store, dir := initConfiguredBadgerStore(t, &StoreConfig{StrictBlockOrder: true})
+	defer removeBadgerStore(store, dir)
+
+	//the first block of an empty store may use any index
+	if err := store.SetBlock(types.NewBlock(5, 1, [][]byte{[]byte("tx")})); err != nil {
+		t.Fatal(err)
+	}
+
+	//in order
+	if err := store.SetBlock(types.NewBlock(6, 2, [][]byte{[]byte("tx")})); err != nil {
+		t.Fatal(err)
+	}
+
+	//gap
+	err := store.SetBlock(types.NewBlock(8, 3, [][]byte{[]byte("tx")}))
+	if !errors.Is(err, errors.NonContiguousBlock) {
+		t.Fatalf("expected NonContiguousBlock error for gap, got %v", err)
+	}
+
+	//duplicate index
+	err = store.SetBlock(types.NewBlock(6, 3, [][]byte{[]byte("tx")}))
+	if !errors.Is(err, errors.NonContiguousBlock) {
+		t.Fatalf("expected NonContiguousBlock error for duplicate, got %v", err)
+	}
+
+	//the rejected blocks must not have clobbered the watermark
+	if err := store.SetBlock(types.NewBlock(7, 3, [][]byte{[]byte("tx")})); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStrictCreators(t *testing.T) {
+	store, dir := initConfiguredBadgerStore(t, &StoreConfig{StrictCreators: true})
+	defer removeBadgerStore(store, dir)
+
+	//a known creator is accepted
+	if err := store.SetComet(newTestComet(0xAA, 0, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	//an unknown creator is rejected before anything is written
+	unknown := newTestComet(0xDD, 0, 1)
+	err := store.SetComet(unknown)
+	if !errors.Is(err, errors.UnknownCreator) {
+		t.Fatalf("expected UnknownCreator error, got %v", err)
+	}
+	if _, err := store.GetComet(unknown.Hex()); err == nil {
+		t.Fatal("expected the rejected event to be absent from the store")
+	}
+}
+
+func TestPinKeys(t *testing.T) {
+	store, dir := initConfiguredBadgerStore(t, &StoreConfig{PinKeys: []string{"roots", "last-round", "last-block"}})
+	defer removeBadgerStore(store, dir)
+
+	round := types.NewRoundInfo()
+	round.AddEvent("0xEVENT", true)
+	if err := store.SetRound(0, *round); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetBlock(types.NewBlock(0, 0, [][]byte{[]byte("tx")})); err != nil {
+		t.Fatal(err)
+	}
+
+	//re-resolve the pins now that data exists, then evict everything else
+	if err := store.RefreshFromDisk(); err != nil {
+		t.Fatal(err)
+	}
+	store.FlushCache()
+
+	//the pinned round and block are still served from memory
+	before := store.Metrics().CacheHits
+	if _, err := store.GetRound(0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GetBlock(0); err != nil {
+		t.Fatal(err)
+	}
+	if hits := store.Metrics().CacheHits - before; hits != 2 {
+		t.Fatalf("expected 2 cache hits on pinned entries, got %d", hits)
+	}
+
+	//unknown pin names are rejected at open
+	badDir, err := ioutil.TempDir("", "badger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(badDir)
+	participants := map[string]int{"0xAA": 0}
+	if _, err := NewBadgerStoreWithConfig(participants, 10, badDir, &StoreConfig{PinKeys: []string{"everything"}}); err == nil {
+		t.Fatal("expected an error for an unknown pin key")
+	}
+}
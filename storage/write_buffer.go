@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/paradigm-network/paradigm/errors"
+	"github.com/paradigm-network/paradigm/types"
+)
+
+//writeBuffer decouples SetComet from the db transaction: events are queued
+//and flushed in batches by a single background goroutine. The caller still
+//updates the cache synchronously so reads stay coherent; only the durable
+//write is deferred.
+type writeBuffer struct {
+	ch        chan types.Comet
+	depth     int64 //events enqueued but not yet flushed
+	maxDepth  int64
+	lastFlush int64 //duration of the last flush in nanoseconds
+	done      chan struct{}
+}
+
+func newWriteBuffer(s *BadgerStore, size int) *writeBuffer {
+	b := &writeBuffer{
+		ch:   make(chan types.Comet, size),
+		done: make(chan struct{}),
+	}
+	go b.run(s)
+	return b
+}
+
+//enqueue adds an event to the queue. When the queue is full it either blocks
+//until the flusher drains (the default) or, with nonBlocking, reports
+//errors.Backpressure so the caller can shed load instead of piling up.
+func (b *writeBuffer) enqueue(comet types.Comet, nonBlocking bool) error {
+	select {
+	case b.ch <- comet:
+	default:
+		if nonBlocking {
+			return errors.NewStoreErr(errors.Backpressure, comet.Hex())
+		}
+		b.ch <- comet
+	}
+	d := atomic.AddInt64(&b.depth, 1)
+	for {
+		cur := atomic.LoadInt64(&b.maxDepth)
+		if d <= cur || atomic.CompareAndSwapInt64(&b.maxDepth, cur, d) {
+			break
+		}
+	}
+	return nil
+}
+
+//run drains the queue, batching whatever has accumulated into a single db
+//transaction. Flush errors can no longer be returned to the caller; they are
+//counted in the store metrics and logged.
+func (b *writeBuffer) run(s *BadgerStore) {
+	defer close(b.done)
+	for {
+		comet, ok := <-b.ch
+		if !ok {
+			return
+		}
+		batch := []types.Comet{comet}
+	drain:
+		for {
+			select {
+			case c, more := <-b.ch:
+				if !more {
+					break drain
+				}
+				batch = append(batch, c)
+			default:
+				break drain
+			}
+		}
+		start := time.Now()
+		err := s.dbSetEvents(batch)
+		atomic.StoreInt64(&b.lastFlush, int64(time.Since(start)))
+		atomic.AddInt64(&b.depth, -int64(len(batch)))
+		s.metrics.write(err)
+		if err != nil && s.logger != nil {
+			s.logger.Error().Err(err).Int("batch", len(batch)).Msg("write buffer flush failed")
+		}
+	}
+}
+
+//close flushes everything still queued and waits for the flusher to exit
+func (b *writeBuffer) close() {
+	close(b.ch)
+	<-b.done
+}
+
+//drain blocks until everything enqueued so far has been flushed to the db,
+//without closing the buffer. Events enqueued concurrently with the wait may
+//or may not be included.
+func (b *writeBuffer) drain() {
+	for atomic.LoadInt64(&b.depth) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+//WriteBufferStats reports the buffered-write queue: its current depth, the
+//high-water mark since the store was opened, and how long the last flush
+//transaction took. All zeroes when buffering is disabled.
+func (s *BadgerStore) WriteBufferStats() (depth, maxDepth int, lastFlushLatency time.Duration) {
+	if s.writeBuf == nil {
+		return 0, 0, 0
+	}
+	return int(atomic.LoadInt64(&s.writeBuf.depth)),
+		int(atomic.LoadInt64(&s.writeBuf.maxDepth)),
+		time.Duration(atomic.LoadInt64(&s.writeBuf.lastFlush))
+}
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"github.com/paradigm-network/paradigm/types"
+)
+
+//mirrorTarget pairs the secondary with its error callback so both travel
+//through one atomic load/store and a writer can never observe a new mirror
+//with the old callback
+type mirrorTarget struct {
+	store   *BadgerStore
+	onError func(error)
+}
+
+//WriteMirror registers a secondary store that receives the same SetComet,
+//SetRound and SetBlock writes as this one, keeping a hot standby nearly
+//current without full replication machinery. Mirroring is best-effort: each
+//write is applied to the secondary after the primary write has succeeded, in
+//the caller's goroutine, so the per-caller write order is preserved on both
+//sides. A failed mirror write never fails the primary; it is reported
+//through onError (may be nil) and logged, and the standby is expected to
+//re-sync through its normal catch-up path. Passing nil removes the mirror;
+//installing, swapping and removing are all safe while writes are in flight.
+func (s *BadgerStore) WriteMirror(secondary *BadgerStore, onError func(error)) {
+	s.mirror.Store(mirrorTarget{store: secondary, onError: onError})
+}
+
+func (s *BadgerStore) mirrorWrite(fn func(m *BadgerStore) error) {
+	t, _ := s.mirror.Load().(mirrorTarget)
+	if t.store == nil {
+		return
+	}
+	if err := fn(t.store); err != nil {
+		if t.onError != nil {
+			t.onError(err)
+		}
+		s.logger.Error().Err(err).Msg("mirror write failed")
+	}
+}
+
+func (s *BadgerStore) mirrorComet(comet types.Comet) {
+	s.mirrorWrite(func(m *BadgerStore) error {
+		return m.SetComet(comet)
+	})
+}
+
+func (s *BadgerStore) mirrorRound(r int, round types.RoundInfo) {
+	s.mirrorWrite(func(m *BadgerStore) error {
+		return m.SetRound(r, round)
+	})
+}
+
+func (s *BadgerStore) mirrorBlock(block types.Block) {
+	s.mirrorWrite(func(m *BadgerStore) error {
+		return m.SetBlock(block)
+	})
+}